@@ -2,4 +2,8 @@ module mdbook-gen
 
 go 1.25.0
 
-require gopkg.in/yaml.v3 v3.0.1
+require (
+	github.com/mozillazg/go-pinyin v0.21.0
+	golang.org/x/text v0.33.0
+	gopkg.in/yaml.v3 v3.0.1
+)
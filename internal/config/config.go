@@ -6,4 +6,145 @@ type Config struct {
 	Copyright  string         `yaml:"copyright"`
 	OutputDir  string         `yaml:"output_dir"`
 	Categories map[int]string `yaml:"categories"`
+
+	Admonitions AdmonitionConfig `yaml:"admonitions"`
+	Math        MathConfig       `yaml:"math"`
+	Figures     FiguresConfig    `yaml:"figures"`
+	Glossary    GlossaryConfig   `yaml:"glossary"`
+	Index       IndexConfig      `yaml:"index"`
+
+	Bibliography BibliographyConfig `yaml:"bibliography"`
+	HTML         HTMLConfig         `yaml:"html"`
+	Headings     HeadingsConfig     `yaml:"headings"`
+	Search       SearchConfig       `yaml:"search"`
+	Sidebar      SidebarConfig      `yaml:"sidebar"`
+	Reading      ReadingConfig      `yaml:"reading"`
+	Navigation   NavigationConfig   `yaml:"navigation"`
+	Contents     ContentsConfig     `yaml:"contents"`
+	TOC          TOCConfig          `yaml:"toc"`
+	Theme        ThemeConfig        `yaml:"theme"`
+	URLs         URLsConfig         `yaml:"urls"`
+	Redirects    RedirectsConfig    `yaml:"redirects"`
+}
+
+// AdmonitionConfig 控制 "> [!NOTE]" 形式的提示框
+type AdmonitionConfig struct {
+	// LegacyEmoji 为 true 时，没有 [!TYPE] 标记的引用块仍按 💡/⚠️/提示/注意 等字样猜测类型
+	LegacyEmoji bool                  `yaml:"legacy_emoji"`
+	Types       map[string]Admonition `yaml:"types"` // 自定义或覆盖内置类型，键为类型名 (如 EXAMPLE)
+}
+
+type Admonition struct {
+	Class string `yaml:"class"`
+	Label string `yaml:"label"`
+	Icon  string `yaml:"icon"`
+}
+
+// MathConfig 控制 $...$ 和 $$...$$ 公式，公式在构建时转换为 MathML
+type MathConfig struct {
+	Disabled bool   `yaml:"disabled"` // 关闭公式识别，$ 按普通字符处理
+	Fallback string `yaml:"fallback"` // "mathjax": 无法转换的公式交给浏览器端 MathJax 渲染
+}
+
+// FiguresConfig 控制图片和表格的编号
+type FiguresConfig struct {
+	FigureLabel string `yaml:"figure_label"` // 默认 "图"
+	TableLabel  string `yaml:"table_label"`  // 默认 "表"
+	HideLists   bool   `yaml:"hide_lists"`   // 不生成插图目录和表格目录页面
+
+	FigureListTitle string `yaml:"figure_list_title"` // 插图目录页面的标题，默认 "插图目录"
+	TableListTitle  string `yaml:"table_list_title"`  // 表格目录页面的标题，默认 "表格目录"
+}
+
+// GlossaryConfig 控制术语表
+type GlossaryConfig struct {
+	File       string `yaml:"file"`         // 术语表文件，默认 glossary.yaml (不存在时不启用)
+	NoAutoLink bool   `yaml:"no_auto_link"` // 只标记 {术语}，不自动链接正文中的术语
+}
+
+// IndexConfig 控制由 {index: 词条} 标记生成的索引页面
+type IndexConfig struct {
+	Title  string `yaml:"title"`  // 默认 "索引"
+	Locale string `yaml:"locale"` // 词条排序使用的语言，默认 zh (按拼音)
+}
+
+// BibliographyConfig 控制参考文献和 [@key] 引用
+type BibliographyConfig struct {
+	File      string `yaml:"file"`      // BibTeX (.bib) 或 CSL-JSON (.json) 文件，未设置时不识别引用
+	Style     string `yaml:"style"`     // "numeric" (默认): [1]；"author-year": (Pike, 2012)
+	Placement string `yaml:"placement"` // "chapter" (默认): 列在每章末尾；"book": 全书末尾生成参考文献页面
+	Title     string `yaml:"title"`     // 默认 "参考文献"
+}
+
+// HTMLConfig 控制正文中的 HTML 和页面的安全设置
+type HTMLConfig struct {
+	Raw            string   `yaml:"raw"`             // 正文中的 HTML 标签: sanitize (默认，只保留白名单中的标签和属性) | allow | escape
+	AllowedTags    []string `yaml:"allowed_tags"`    // sanitize 时额外允许的标签
+	AllowedSchemes []string `yaml:"allowed_schemes"` // 链接和图片允许的协议，默认 http、https、mailto、tel、ftp
+	CSP            string   `yaml:"csp"`             // Content-Security-Policy，"default" 使用内置策略，为空时不输出
+}
+
+// HeadingsConfig 控制标题的 ID 和链接
+type HeadingsConfig struct {
+	Slug         string `yaml:"slug"`          // 默认只保留 ASCII 字母、数字和汉字 | keep-unicode (保留各种文字的字母和数字) | ascii-transliteration (去掉重音，只保留 ASCII) | pinyin (汉字转为拼音)
+	NoPermalinks bool   `yaml:"no_permalinks"` // 不在 H2–H4 后面添加 # 链接
+	Numbers      []int  `yaml:"numbers"`       // 自动编号的标题级别，例如 [2, 3] 给 H2、H3 编号 (3.1、3.1.2)
+	SectionLabel string `yaml:"section_label"` // @sec: 引用的文字，%s 为编号，默认 "第 %s 节"
+}
+
+// SearchConfig 控制全文搜索
+type SearchConfig struct {
+	Disabled bool `yaml:"disabled"` // 不生成搜索索引和搜索框
+}
+
+// SidebarConfig 控制侧边栏目录
+type SidebarConfig struct {
+	Enabled bool `yaml:"enabled"` // 在每一页左侧显示全书目录
+}
+
+// ReadingConfig 控制页面上的阅读辅助
+type ReadingConfig struct {
+	Outline  bool `yaml:"outline"`  // 右侧显示本页的 H2/H3 目录
+	Progress bool `yaml:"progress"` // 顶部显示阅读进度条
+	Time     bool `yaml:"time"`     // 章节开头显示预计阅读时间
+}
+
+// NavigationConfig 控制上一章/下一章链接
+type NavigationConfig struct {
+	SkipContents bool `yaml:"skip_contents"` // 翻页时跳过目录页
+}
+
+// ContentsConfig 控制自动生成的目录页和封面
+type ContentsConfig struct {
+	Landing string `yaml:"landing"` // 没有 00.00-frontmatter.md 时 index.html 的内容: cover (默认，生成封面) | contents (目录页)
+}
+
+// TOCConfig 控制目录页、侧边栏和翻页链接中的章节列表
+type TOCConfig struct {
+	Depth          int      `yaml:"depth"`           // 1: 只列章节 | 2: 到二级标题 (默认) | 3: 到三级标题
+	HideNumbers    bool     `yaml:"hide_numbers"`    // 不显示章号
+	Numbering      string   `yaml:"numbering"`       // arabic (默认，2.1.) | chinese (第二章、第一节) | roman (II.1.)
+	FrontMatter    bool     `yaml:"front_matter"`    // 目录页中也列出前言
+	FrontNumbering string   `yaml:"front_numbering"` // none (默认) | roman (前言编号为 i.)
+	StripPrefixes  []string `yaml:"strip_prefixes"`  // 从章节标题开头去掉的正则，默认去掉 "第 N 章："
+}
+
+// ThemeConfig 控制页面主题和阅读设置面板
+type ThemeConfig struct {
+	Default string `yaml:"default"`  // auto (默认，跟随系统) | light | dark | sepia，读者在面板中的选择优先
+	NoPanel bool   `yaml:"no_panel"` // 不显示阅读设置面板
+}
+
+// URLsConfig 控制输出的文件名和链接地址
+type URLsConfig struct {
+	Style   string `yaml:"style"`    // numbered (默认，01.00-intro.html) | slug (intro.html) | directory (intro/index.html)
+	BaseURL string `yaml:"base_url"` // 书籍所在的地址或路径，例如 /docs/book/，设置后所有链接都使用它
+}
+
+// RedirectsConfig 控制页面改名后从旧地址跳转到新地址的页面
+type RedirectsConfig struct {
+	Disabled bool              `yaml:"disabled"` // 不记录文件名，也不生成跳转页面
+	Manifest string            `yaml:"manifest"` // 记录各页面历史文件名的文件，相对于书籍根目录，默认 book-manifest.json
+	Server   string            `yaml:"server"`   // 另外生成服务器的跳转规则: netlify (_redirects) | nginx (redirects.map)
+	Pages    map[string]string `yaml:"pages"`    // 手动添加的跳转: 旧地址 -> 页面文件名或外部地址
 }
@@ -0,0 +1,120 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"mdbook-gen/internal/config"
+)
+
+// 内置的提示框类型，与 GitHub 的 > [!NOTE] 语法一致
+var builtinAdmonitions = map[string]config.Admonition{
+	"NOTE":      {Class: "note", Label: "Note:"},
+	"TIP":       {Class: "hint", Label: "Tip:"},
+	"IMPORTANT": {Class: "important", Label: "Important:"},
+	"WARNING":   {Class: "warning", Label: "Warning:"},
+	"CAUTION":   {Class: "caution", Label: "Caution:"},
+}
+
+var admonitionRe = regexp.MustCompile(`^\s*\[!([A-Za-z][\w-]*)\]\s*(.*)$`)
+
+// lookupAdmonition 按类型名查找提示框定义，book.yaml 中的配置优先于内置类型
+func lookupAdmonition(name string) (config.Admonition, bool) {
+	name = strings.ToUpper(name)
+	t, ok := builtinAdmonitions[name]
+	if custom, found := conf.Admonitions.Types[name]; found {
+		if custom.Class != "" {
+			t.Class = custom.Class
+		}
+		if custom.Label != "" {
+			t.Label = custom.Label
+		}
+		if custom.Icon != "" {
+			t.Icon = custom.Icon
+		}
+		ok = true
+	}
+	if t.Class == "" {
+		t.Class = strings.ToLower(name)
+	}
+	if t.Label == "" {
+		t.Label = name[:1] + strings.ToLower(name[1:]) + ":"
+	}
+	return t, ok
+}
+
+// stripQuoteMarker 去掉引用块行首的 "> " 或 ">"
+func stripQuoteMarker(line string) string {
+	if strings.HasPrefix(line, "> ") {
+		return strings.TrimPrefix(line, "> ")
+	}
+	return strings.TrimPrefix(line, ">")
+}
+
+// renderBlockquote 输出一个引用块。
+// 首行为 [!TYPE] 时输出对应的 aside 提示框，正文按完整的 Markdown 渲染 (可包含多段、列表和代码)；
+// 否则输出普通 blockquote，开启 legacy_emoji 时沿用旧的表情符号猜测逻辑。
+func renderBlockquote(quote source, chapterNum string, isFront bool) string {
+	m := admonitionRe.FindStringSubmatch(quote.Lines[0])
+	if m == nil {
+		if conf.Admonitions.LegacyEmoji {
+			return renderLegacyAside(quote.Lines)
+		}
+		return "<blockquote>\n" + markdownToBookHTML(quote, chapterNum, isFront) + "</blockquote>\n"
+	}
+
+	t, ok := lookupAdmonition(m[1])
+	if !ok {
+		fmt.Printf("Warning: %s: 未知的提示框类型 [!%s]，请在 book.yaml 的 admonitions.types 中定义\n", quote.posAt(0), m[1])
+	}
+
+	title := escapeHTML(t.Label)
+	if m[2] != "" {
+		title = processInline(m[2])
+		// "> [!NOTE] **标题**" 已经整个加粗，去掉这一层，避免 strong 套 strong
+		if inner, ok := strings.CutPrefix(title, "<strong>"); ok && strings.HasSuffix(inner, "</strong>") && !strings.Contains(inner, "<strong>") {
+			title = strings.TrimSuffix(inner, "</strong>")
+		}
+	}
+	if t.Icon != "" {
+		title = fmt.Sprintf("<span class=\"icon\" aria-hidden=\"true\">%s</span> %s", escapeHTML(t.Icon), title)
+	}
+	head := fmt.Sprintf("<strong>%s</strong>", title)
+
+	body := markdownToBookHTML(source{Lines: quote.Lines[1:], Pos: quote.Pos[1:]}, chapterNum, isFront)
+	// 默认标签和原来一样放在第一段开头；自定义标题或正文不以段落开头时单独成段
+	if m[2] == "" && strings.HasPrefix(body, "<p>") {
+		body = "<p>" + head + " " + strings.TrimPrefix(body, "<p>")
+	} else {
+		body = "<p>" + head + "</p>\n" + body
+	}
+	return fmt.Sprintf("<aside class=\"%s\">\n%s</aside>\n", escapeAttr(t.Class), body)
+}
+
+// renderLegacyAside 是旧版的引用块渲染: 根据 💡/⚠️/提示/注意 等字样猜测类型，各行以 <br> 连接
+func renderLegacyAside(quoteLines []string) string {
+	fullContent := strings.Join(quoteLines, "\n")
+	class := "note"
+	label := "Note:"
+	if strings.Contains(fullContent, "💡") || strings.Contains(fullContent, "提示") {
+		class = "hint"
+		label = "Hint:"
+	} else if strings.Contains(fullContent, "⚠️") || strings.Contains(fullContent, "注意") || strings.Contains(fullContent, "警告") || strings.Contains(fullContent, "重要") {
+		class = "important"
+		label = "Important:"
+	}
+	fullContent = regexp.MustCompile(`[💡⚠️❌✅]`).ReplaceAllString(fullContent, "")
+	fullContent = strings.TrimSpace(fullContent)
+
+	htmlContent := ""
+	for _, qline := range strings.Split(fullContent, "\n") {
+		qline = strings.TrimSpace(qline)
+		if qline != "" {
+			htmlContent += processInline(qline) + "<br>\n"
+		}
+	}
+	htmlContent = strings.TrimSuffix(htmlContent, "<br>\n")
+
+	return fmt.Sprintf("<aside class=\"%s\"><p>\n<strong>%s</strong> %s\n</p></aside>\n", class, label, htmlContent)
+}
@@ -0,0 +1,96 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"mdbook-gen/internal/config"
+)
+
+func TestAdmonitions(t *testing.T) {
+	example := config.AdmonitionConfig{Types: map[string]config.Admonition{
+		"EXAMPLE": {Class: "example", Label: "示例：", Icon: "🧪"},
+		"NOTE":    {Label: "注："},
+		"BAD":     {Class: `x" onclick="alert(1)`, Label: "<b>坏</b>", Icon: "<img src=x>"},
+	}}
+	tests := []struct {
+		name, md    string
+		admonitions config.AdmonitionConfig
+		want        string
+		warning     string
+	}{
+		{
+			name: "内置类型",
+			md:   "> [!TIP]\n> 正文",
+			want: "<aside class=\"hint\">\n<p><strong>Tip:</strong> 正文</p>\n</aside>\n",
+		},
+		{
+			name: "多段正文",
+			md:   "> [!WARNING]\n> 第一段\n>\n> - 列表",
+			want: "<aside class=\"warning\">\n<p><strong>Warning:</strong> 第一段</p>\n<ul>\n<li><p>列表</p></li>\n</ul>\n</aside>\n",
+		},
+		{
+			name:        "配置中的自定义类型",
+			md:          "> [!example]\n> 正文",
+			admonitions: example,
+			want:        "<aside class=\"example\">\n<p><strong><span class=\"icon\" aria-hidden=\"true\">🧪</span> 示例：</strong> 正文</p>\n</aside>\n",
+		},
+		{
+			name:        "覆盖内置类型的标签",
+			md:          "> [!NOTE]\n> 正文",
+			admonitions: example,
+			want:        "<aside class=\"note\">\n<p><strong>注：</strong> 正文</p>\n</aside>\n",
+		},
+		{
+			name:        "配置中的 HTML 被转义",
+			md:          "> [!BAD]\n> 正文",
+			admonitions: example,
+			want:        "<aside class=\"x&quot; onclick=&quot;alert(1)\">\n<p><strong><span class=\"icon\" aria-hidden=\"true\">&lt;img src=x&gt;</span> &lt;b&gt;坏&lt;/b&gt;</strong> 正文</p>\n</aside>\n",
+		},
+		{
+			name: "自定义标题",
+			md:   "> [!WARNING] 数据 `丢失`\n> 正文",
+			want: "<aside class=\"warning\">\n<p><strong>数据 <code>丢失</code></strong></p>\n<p>正文</p>\n</aside>\n",
+		},
+		{
+			name: "加粗的自定义标题",
+			md:   "> [!NOTE] **标题**\n> 正文",
+			want: "<aside class=\"note\">\n<p><strong>标题</strong></p>\n<p>正文</p>\n</aside>\n",
+		},
+		{
+			name:    "未知类型",
+			md:      "> [!NOSUCH]\n> 正文",
+			want:    "<aside class=\"nosuch\">\n<p><strong>Nosuch:</strong> 正文</p>\n</aside>\n",
+			warning: "Warning: test.md:1: 未知的提示框类型 [!NOSUCH]，请在 book.yaml 的 admonitions.types 中定义\n",
+		},
+		{
+			name: "普通引用块",
+			md:   "> 💡 提示内容",
+			want: "<blockquote>\n<p>💡 提示内容</p>\n</blockquote>\n",
+		},
+		{
+			name:        "legacy_emoji",
+			md:          "> 💡 提示内容\n> 第二行",
+			admonitions: config.AdmonitionConfig{LegacyEmoji: true},
+			want:        "<aside class=\"hint\"><p>\n<strong>Hint:</strong> 提示内容<br>\n第二行\n</p></aside>\n",
+		},
+		{
+			name:        "legacy_emoji 不影响 [!TYPE]",
+			md:          "> [!CAUTION]\n> 注意",
+			admonitions: config.AdmonitionConfig{LegacyEmoji: true},
+			want:        "<aside class=\"caution\">\n<p><strong>Caution:</strong> 注意</p>\n</aside>\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out string
+			warnings := captureOutput(t, func() { out = renderMarkdown(t, config.Config{Admonitions: tt.admonitions}, tt.md) })
+			if got := strings.TrimSpace(strings.ReplaceAll(out, "\n\n", "\n")); got != strings.TrimSpace(tt.want) {
+				t.Errorf("输出:\n%s\n应该是:\n%s", got, tt.want)
+			}
+			if warnings != tt.warning {
+				t.Errorf("警告 %q，应该是 %q", warnings, tt.warning)
+			}
+		})
+	}
+}
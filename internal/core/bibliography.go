@@ -0,0 +1,740 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"html/template"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+var (
+	// [@key]、[@key, p. 33]、[@a; @b]、[-@key] (作者-年份格式下只显示年份)
+	citationRe     = regexp.MustCompile(`\[(-?@[^\[\]\n]+)\](\(?)`)
+	citationItemRe = regexp.MustCompile(`^(-?)@([\w:./+-]*[\w])\s*(?:,\s*(.*))?$`)
+	// processInline 输出的占位标记，由 resolveCitations 替换
+	citationMarkRe = regexp.MustCompile(`<cite class="citation" data-cite="([^"]*)"></cite>`)
+)
+
+const referencesFile = "references.html"
+
+// bibName 是一位作者
+type bibName struct {
+	Family string
+	Given  string
+}
+
+// bibEntry 是 BibTeX 或 CSL-JSON 中的一条文献
+type bibEntry struct {
+	Key       string
+	Authors   []bibName
+	Title     string
+	Container string // 期刊、会议论文集、丛书 (如 RFC)
+	Publisher string
+	Year      string
+	URL       string
+	DOI       string
+
+	suffix string // 作者-年份格式下同一作者同一年的多篇文献: 2012a, 2012b
+}
+
+type bibliography struct {
+	entries map[string]*bibEntry
+	style   string
+	file    string
+}
+
+// loadBibliography 读取 book.yaml 中 bibliography.file 指定的文献库，未配置时返回 nil
+func loadBibliography(rootDir string) (*bibliography, error) {
+	name := conf.Bibliography.File
+	if name == "" {
+		return nil, nil
+	}
+	data, err := os.ReadFile(filepath.Join(rootDir, name))
+	if err != nil {
+		return nil, fmt.Errorf("无法读取参考文献 %s: %w", name, err)
+	}
+
+	var entries []*bibEntry
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".json":
+		entries, err = parseCSLJSON(data)
+	case ".bib", ".bibtex":
+		entries, err = parseBibTeX(string(data))
+	default:
+		return nil, fmt.Errorf("不支持的参考文献格式 %s，请使用 .bib 或 .json (CSL-JSON)", name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("解析参考文献 %s 失败: %w", name, err)
+	}
+
+	b := &bibliography{entries: make(map[string]*bibEntry), style: conf.Bibliography.Style, file: name}
+	switch b.style {
+	case "":
+		b.style = "numeric"
+	case "numeric", "author-year":
+	default:
+		fmt.Printf("Warning: 未知的引用格式 bibliography.style %q，使用 numeric\n", b.style)
+		b.style = "numeric"
+	}
+	for _, e := range entries {
+		if _, dup := b.entries[e.Key]; dup {
+			fmt.Printf("Warning: %s: 文献 %s 重复定义，使用后一个\n", name, e.Key)
+		}
+		b.entries[e.Key] = e
+	}
+	b.disambiguate()
+	return b, nil
+}
+
+// citation 是一个引用标记中的一项
+type citation struct {
+	Key          string
+	Locator      string // 页码等定位信息，如 "p. 33"
+	SuppressName bool
+}
+
+func parseCitations(raw string) ([]citation, bool) {
+	var items []citation
+	for _, part := range strings.Split(raw, ";") {
+		m := citationItemRe.FindStringSubmatch(strings.TrimSpace(part))
+		if m == nil {
+			return nil, false
+		}
+		items = append(items, citation{Key: m[2], Locator: strings.TrimSpace(m[3]), SuppressName: m[1] == "-"})
+	}
+	return items, true
+}
+
+// citationMark 由 processInline 调用，不是合法的引用时原样返回
+func citationMark(m []string) string {
+	if m[2] == "(" {
+		return "" // [@xxx](url) 是链接
+	}
+	if _, ok := parseCitations(m[1]); !ok {
+		return ""
+	}
+	return fmt.Sprintf(`<cite class="citation" data-cite="%s"></cite>`, escapeAttr(m[1]))
+}
+
+// resolveCitations 把各章中的引用标记替换成引用文字，并生成参考文献列表。
+// placement 为 chapter 时列表追加在各章末尾；为 book 时返回单独的参考文献页面。
+// 引用了文献库中不存在的条目时返回错误。
+func (b *bibliography) resolveCitations(chapters []Chapter) (*Chapter, error) {
+	title := conf.Bibliography.Title
+	if title == "" {
+		title = "参考文献"
+	}
+	perChapter := conf.Bibliography.Placement != "book"
+	if p := conf.Bibliography.Placement; p != "" && p != "book" && p != "chapter" {
+		fmt.Printf("Warning: 未知的 bibliography.placement %q，使用 chapter\n", p)
+	}
+
+	var unknown []string
+	var order []*bibEntry
+	num := make(map[*bibEntry]int)
+
+	for i := range chapters {
+		ch := &chapters[i]
+		if perChapter {
+			order = nil
+			num = make(map[*bibEntry]int)
+		}
+		refPage := ""
+		if !perChapter {
+			refPage = referencesFile
+		}
+		content := citationMarkRe.ReplaceAllStringFunc(string(ch.Content), func(mark string) string {
+			items, _ := parseCitations(html.UnescapeString(citationMarkRe.FindStringSubmatch(mark)[1]))
+			var parts []string
+			for _, it := range items {
+				e, ok := b.entries[it.Key]
+				if !ok {
+					unknown = append(unknown, fmt.Sprintf("%s: 引用了未定义的文献 @%s", chapterDisplayPath(*ch), it.Key))
+					parts = append(parts, "@"+escapeHTML(it.Key)+"?")
+					continue
+				}
+				if num[e] == 0 {
+					order = append(order, e)
+					num[e] = len(order)
+				}
+				text := b.citeText(e, num[e], it)
+				parts = append(parts, fmt.Sprintf(`<a href="%s" role="doc-biblioref">%s</a>`, pageHref(refPage+"#"+refAnchor(e.Key)), text))
+			}
+			if b.style == "author-year" {
+				return `<span class="citation">(` + strings.Join(parts, "; ") + `)</span>`
+			}
+			return `<span class="citation">[` + strings.Join(parts, ", ") + `]</span>`
+		})
+		if perChapter && len(order) > 0 {
+			content += "<section class=\"references\" role=\"doc-bibliography\">\n" +
+				fmt.Sprintf("<h2 id=\"references\">%s</h2>\n", escapeHTML(title)) + b.list(order) + "</section>\n"
+		}
+		ch.Content = template.HTML(content)
+	}
+
+	if len(unknown) > 0 {
+		for _, msg := range unknown {
+			fmt.Println("Error:", msg)
+		}
+		return nil, fmt.Errorf("有 %d 处引用在 %s 中找不到", len(unknown), b.file)
+	}
+	if perChapter || len(order) == 0 {
+		return nil, nil
+	}
+	return &Chapter{
+		ID:         strings.TrimSuffix(referencesFile, ".html"),
+		Title:      title,
+		OutputFile: referencesFile,
+		Content: template.HTML(fmt.Sprintf("<h1 id=\"references\">%s</h1>\n\n<section class=\"references\" role=\"doc-bibliography\">\n%s</section>\n",
+			escapeHTML(title), b.list(order))),
+	}, nil
+}
+
+// citeText 返回正文中的引用文字: 数字格式为编号，作者-年份格式为 "Pike, 2012"
+func (b *bibliography) citeText(e *bibEntry, n int, it citation) string {
+	var s string
+	if b.style == "author-year" {
+		s = escapeHTML(e.year())
+		if !it.SuppressName {
+			s = escapeHTML(e.shortAuthors()) + ", " + s
+		}
+	} else {
+		s = strconv.Itoa(n)
+	}
+	if it.Locator != "" {
+		s += ", " + escapeHTML(it.Locator)
+	}
+	return s
+}
+
+// refAnchor 返回文献条目在参考文献列表中的锚点。CSL-JSON 的 id 可以包含引号等字符，需要转义
+func refAnchor(key string) string {
+	return "ref-" + escapeAttr(key)
+}
+
+// list 输出参考文献列表。数字格式按第一次引用的顺序编号，作者-年份格式按作者和年份排序。
+func (b *bibliography) list(cited []*bibEntry) string {
+	var buf bytes.Buffer
+	if b.style != "author-year" {
+		buf.WriteString("<ol>\n")
+		for _, e := range cited {
+			buf.WriteString(fmt.Sprintf("<li id=\"%s\">%s</li>\n", refAnchor(e.Key), e.format(false)))
+		}
+		buf.WriteString("</ol>\n")
+		return buf.String()
+	}
+
+	sorted := append([]*bibEntry(nil), cited...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, c := sorted[i], sorted[j]
+		if a.sortName() != c.sortName() {
+			return a.sortName() < c.sortName()
+		}
+		return a.year() < c.year()
+	})
+	buf.WriteString("<ul>\n")
+	for _, e := range sorted {
+		buf.WriteString(fmt.Sprintf("<li id=\"%s\">%s</li>\n", refAnchor(e.Key), e.format(true)))
+	}
+	buf.WriteString("</ul>\n")
+	return buf.String()
+}
+
+// format 输出一条文献。
+// 数字格式: Rob Pike, Russ Cox. <cite>标题</cite>. 期刊. 出版者, 2012.
+// 作者-年份格式: Pike, R., &amp; Cox, R. (2012). <cite>标题</cite>. 期刊. 出版者.
+func (e *bibEntry) format(authorYear bool) string {
+	var parts []string
+	names := make([]string, len(e.Authors))
+	for i, a := range e.Authors {
+		if authorYear {
+			names[i] = a.inverted()
+		} else {
+			names[i] = a.full()
+		}
+	}
+	authors := strings.Join(names, ", ")
+	if authorYear && len(names) > 1 {
+		authors = strings.Join(names[:len(names)-1], ", ") + ", & " + names[len(names)-1]
+	}
+
+	if authorYear {
+		head := escapeHTML(authors)
+		if head == "" {
+			head = fmt.Sprintf("<cite>%s</cite>", escapeHTML(e.Title))
+		}
+		parts = append(parts, fmt.Sprintf("%s (%s)", head, escapeHTML(e.year())))
+		if authors != "" && e.Title != "" {
+			parts = append(parts, fmt.Sprintf("<cite>%s</cite>", escapeHTML(e.Title)))
+		}
+	} else {
+		if authors != "" {
+			parts = append(parts, escapeHTML(authors))
+		}
+		if e.Title != "" {
+			parts = append(parts, fmt.Sprintf("<cite>%s</cite>", escapeHTML(e.Title)))
+		}
+	}
+	if e.Container != "" {
+		parts = append(parts, escapeHTML(e.Container))
+	}
+	pub := e.Publisher
+	if !authorYear && e.Year != "" {
+		if pub != "" {
+			pub += ", "
+		}
+		pub += e.Year
+	}
+	if pub != "" {
+		parts = append(parts, escapeHTML(pub))
+	}
+
+	s := strings.Join(parts, ". ")
+	if !strings.HasSuffix(s, ".") {
+		s += "."
+	}
+	if e.DOI != "" {
+		s += fmt.Sprintf(" <a href=\"https://doi.org/%s\">doi:%s</a>", escapeAttr(e.DOI), escapeHTML(e.DOI))
+	} else if e.URL != "" {
+		s += fmt.Sprintf(" <a href=\"%s\">%s</a>", escapeAttr(e.URL), escapeHTML(e.URL))
+	}
+	return s
+}
+
+// full 返回 "Rob Pike"，中文姓名不加空格
+func (n bibName) full() string {
+	if n.Given == "" {
+		return n.Family
+	}
+	if isCJKName(n.Family) {
+		return n.Family + n.Given
+	}
+	return n.Given + " " + n.Family
+}
+
+// inverted 返回 "Pike, R."
+func (n bibName) inverted() string {
+	if n.Given == "" || isCJKName(n.Family) {
+		return n.full()
+	}
+	var initials []string
+	for _, g := range strings.Fields(n.Given) {
+		r := []rune(g)
+		initials = append(initials, string(r[0])+".")
+	}
+	return n.Family + ", " + strings.Join(initials, " ")
+}
+
+func isCJKName(s string) bool {
+	for _, r := range s {
+		if unicode.Is(unicode.Han, r) {
+			return true
+		}
+	}
+	return false
+}
+
+// shortAuthors 返回正文引用中的作者: Pike / Pike & Cox / Pike et al.
+func (e *bibEntry) shortAuthors() string {
+	switch len(e.Authors) {
+	case 0:
+		if e.Title != "" {
+			return e.Title
+		}
+		return e.Key
+	case 1:
+		return e.Authors[0].Family
+	case 2:
+		return e.Authors[0].Family + " & " + e.Authors[1].Family
+	}
+	return e.Authors[0].Family + " et al."
+}
+
+func (e *bibEntry) sortName() string {
+	if len(e.Authors) > 0 {
+		return strings.ToLower(e.Authors[0].Family + " " + e.Authors[0].Given)
+	}
+	return strings.ToLower(e.Title)
+}
+
+func (e *bibEntry) year() string {
+	if e.Year == "" {
+		return "n.d." + e.suffix
+	}
+	return e.Year + e.suffix
+}
+
+// disambiguate 给同一作者同一年份的文献加上 a、b、c 后缀
+func (b *bibliography) disambiguate() {
+	groups := make(map[string][]*bibEntry)
+	for _, e := range b.entries {
+		k := e.shortAuthors() + "\x00" + e.Year
+		groups[k] = append(groups[k], e)
+	}
+	for _, g := range groups {
+		if len(g) < 2 {
+			continue
+		}
+		sort.Slice(g, func(i, j int) bool {
+			if g[i].Title != g[j].Title {
+				return g[i].Title < g[j].Title
+			}
+			return g[i].Key < g[j].Key
+		})
+		for i, e := range g {
+			e.suffix = string(rune('a' + i%26))
+		}
+	}
+}
+
+// parseCSLJSON 解析 CSL-JSON (Zotero 等工具导出的格式)
+func parseCSLJSON(data []byte) ([]*bibEntry, error) {
+	var items []struct {
+		ID     string `json:"id"`
+		Title  string `json:"title"`
+		Author []struct {
+			Family  string `json:"family"`
+			Given   string `json:"given"`
+			Literal string `json:"literal"`
+		} `json:"author"`
+		Issued struct {
+			DateParts [][]json.Number `json:"date-parts"`
+			Literal   string          `json:"literal"`
+		} `json:"issued"`
+		Container  string `json:"container-title"`
+		Collection string `json:"collection-title"`
+		Number     string `json:"number"`
+		Publisher  string `json:"publisher"`
+		URL        string `json:"URL"`
+		DOI        string `json:"DOI"`
+	}
+	if err := json.Unmarshal(data, &items); err != nil {
+		return nil, err
+	}
+
+	var entries []*bibEntry
+	for _, it := range items {
+		e := &bibEntry{Key: it.ID, Title: it.Title, Container: it.Container, Publisher: it.Publisher, URL: it.URL, DOI: it.DOI}
+		for _, a := range it.Author {
+			if a.Literal != "" {
+				e.Authors = append(e.Authors, bibName{Family: a.Literal})
+			} else {
+				e.Authors = append(e.Authors, bibName{Family: a.Family, Given: a.Given})
+			}
+		}
+		if len(it.Issued.DateParts) > 0 && len(it.Issued.DateParts[0]) > 0 {
+			e.Year = it.Issued.DateParts[0][0].String()
+		} else {
+			e.Year = it.Issued.Literal
+		}
+		if e.Container == "" && it.Collection != "" {
+			e.Container = strings.TrimSpace(it.Collection + " " + it.Number)
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// parseBibTeX 解析 BibTeX 文件中的条目，忽略 @comment、@preamble，支持 @string 缩写
+func parseBibTeX(text string) ([]*bibEntry, error) {
+	p := &bibParser{s: text, strings: make(map[string]string)}
+	var entries []*bibEntry
+	for {
+		at := strings.IndexByte(p.s[p.i:], '@')
+		if at < 0 {
+			return entries, nil
+		}
+		p.i += at + 1
+		typ := strings.ToLower(p.ident())
+		p.skipSpace()
+		if p.i >= len(p.s) || (p.s[p.i] != '{' && p.s[p.i] != '(') {
+			continue
+		}
+		end := byte('}')
+		if p.s[p.i] == '(' {
+			end = ')'
+		}
+		p.i++
+
+		switch typ {
+		case "comment", "preamble":
+			p.i-- // 跳过整个括号
+			p.braced()
+			continue
+		case "string":
+			fields, err := p.fields(end)
+			if err != nil {
+				return nil, err
+			}
+			for k, v := range fields {
+				p.strings[k] = v
+			}
+			continue
+		}
+
+		p.skipSpace()
+		key := strings.TrimSpace(p.until(",", end))
+		if p.i < len(p.s) && p.s[p.i] == ',' {
+			p.i++
+		}
+		fields, err := p.fields(end)
+		if err != nil {
+			return nil, fmt.Errorf("条目 %s: %w", key, err)
+		}
+
+		e := &bibEntry{
+			Key:       key,
+			Title:     fields["title"],
+			Container: firstNonEmpty(fields["journal"], fields["booktitle"], fields["howpublished"]),
+			Publisher: firstNonEmpty(fields["publisher"], fields["institution"], fields["organization"], fields["school"]),
+			Year:      fields["year"],
+			URL:       fields["url"],
+			DOI:       fields["doi"],
+		}
+		if e.Container == "" && fields["series"] != "" {
+			e.Container = strings.TrimSpace(fields["series"] + " " + fields["number"])
+		}
+		if e.Year == "" && len(fields["date"]) >= 4 {
+			e.Year = fields["date"][:4]
+		}
+		authors := fields["author"]
+		if authors == "" {
+			authors = fields["editor"]
+		}
+		e.Authors = parseBibNames(authors)
+		entries = append(entries, e)
+	}
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// parseBibNames 解析 "Pike, Rob and Russ Cox and {Go Team}"。
+// 花括号保护的名字 (机构名) 不拆分，LaTeX 转义在 bibValue 中已经处理。
+func parseBibNames(s string) []bibName {
+	var names []bibName
+	for _, raw := range splitBibAnd(s) {
+		raw = strings.TrimSpace(raw)
+		if raw == "" {
+			continue
+		}
+		if strings.HasPrefix(raw, "\x01") {
+			names = append(names, bibName{Family: strings.Trim(raw, "\x01\x02")})
+			continue
+		}
+		raw = strings.NewReplacer("\x01", "", "\x02", "").Replace(raw)
+		if family, given, ok := strings.Cut(raw, ","); ok {
+			names = append(names, bibName{Family: strings.TrimSpace(family), Given: strings.TrimSpace(given)})
+			continue
+		}
+		fields := strings.Fields(raw)
+		if len(fields) == 1 {
+			names = append(names, bibName{Family: fields[0]})
+			continue
+		}
+		names = append(names, bibName{Family: fields[len(fields)-1], Given: strings.Join(fields[:len(fields)-1], " ")})
+	}
+	return names
+}
+
+// splitBibAnd 按顶层的 " and " 拆分作者列表，\x01...\x02 之间的内容 (原来的花括号) 不拆分
+func splitBibAnd(s string) []string {
+	var parts []string
+	depth, last := 0, 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\x01':
+			depth++
+		case '\x02':
+			depth--
+		default:
+			if depth == 0 && strings.HasPrefix(s[i:], " and ") {
+				parts = append(parts, s[last:i])
+				last = i + len(" and ")
+				i += len(" and ") - 1
+			}
+		}
+	}
+	return append(parts, s[last:])
+}
+
+type bibParser struct {
+	s       string
+	i       int
+	strings map[string]string // @string 定义的缩写
+}
+
+func (p *bibParser) skipSpace() {
+	for p.i < len(p.s) && unicode.IsSpace(rune(p.s[p.i])) {
+		p.i++
+	}
+}
+
+func (p *bibParser) ident() string {
+	start := p.i
+	for p.i < len(p.s) && (isWordByte(p.s, p.i) || strings.IndexByte(":-.+/", p.s[p.i]) >= 0) {
+		p.i++
+	}
+	return p.s[start:p.i]
+}
+
+// until 读到 stops 中的任一字符或 end 为止 (不消耗该字符)
+func (p *bibParser) until(stops string, end byte) string {
+	start := p.i
+	for p.i < len(p.s) && strings.IndexByte(stops, p.s[p.i]) < 0 && p.s[p.i] != end {
+		p.i++
+	}
+	return p.s[start:p.i]
+}
+
+// braced 读取一个配对的 {...}，返回括号内的原文
+func (p *bibParser) braced() (string, error) {
+	start := p.i
+	depth := 0
+	for ; p.i < len(p.s); p.i++ {
+		switch p.s[p.i] {
+		case '\\':
+			p.i++
+		case '{':
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				p.i++
+				return p.s[start+1 : p.i-1], nil
+			}
+		}
+	}
+	return "", fmt.Errorf("花括号不匹配")
+}
+
+// fields 读取 name = value, ... 直到 end
+func (p *bibParser) fields(end byte) (map[string]string, error) {
+	fields := make(map[string]string)
+	for {
+		p.skipSpace()
+		if p.i >= len(p.s) {
+			return nil, fmt.Errorf("条目没有结束")
+		}
+		if p.s[p.i] == end {
+			p.i++
+			return fields, nil
+		}
+		if p.s[p.i] == ',' {
+			p.i++
+			continue
+		}
+		name := strings.ToLower(p.ident())
+		if name == "" {
+			return nil, fmt.Errorf("无法识别的字符 %q", p.s[p.i])
+		}
+		p.skipSpace()
+		if p.i >= len(p.s) || p.s[p.i] != '=' {
+			return nil, fmt.Errorf("字段 %s 缺少 =", name)
+		}
+		p.i++
+
+		// 值可以由 # 连接多段
+		var value strings.Builder
+		for {
+			p.skipSpace()
+			if p.i >= len(p.s) {
+				return nil, fmt.Errorf("字段 %s 没有值", name)
+			}
+			switch c := p.s[p.i]; {
+			case c == '{':
+				raw, err := p.braced()
+				if err != nil {
+					return nil, fmt.Errorf("字段 %s: %w", name, err)
+				}
+				value.WriteString(bibValue(raw))
+			case c == '"':
+				p.i++
+				start, depth := p.i, 0
+				for p.i < len(p.s) && (p.s[p.i] != '"' || depth > 0) {
+					if p.s[p.i] == '{' {
+						depth++
+					} else if p.s[p.i] == '}' {
+						depth--
+					}
+					p.i++
+				}
+				value.WriteString(bibValue(p.s[start:p.i]))
+				p.i++
+			default:
+				word := p.ident()
+				if word == "" {
+					return nil, fmt.Errorf("字段 %s 的值无法识别", name)
+				}
+				if v, ok := p.strings[strings.ToLower(word)]; ok {
+					word = v
+				}
+				value.WriteString(word)
+			}
+			p.skipSpace()
+			if p.i < len(p.s) && p.s[p.i] == '#' {
+				p.i++
+				continue
+			}
+			break
+		}
+		v := value.String()
+		if name != "author" && name != "editor" {
+			v = strings.NewReplacer("\x01", "", "\x02", "").Replace(v)
+		}
+		fields[name] = strings.Join(strings.Fields(v), " ")
+	}
+}
+
+var bibAccentRe = regexp.MustCompile(`\\([` + "`" + `'^"~=.])\{?([A-Za-z])\}?`)
+
+// \textit{...}、\emph{...} 等格式命令只保留参数
+var bibCommandRe = regexp.MustCompile(`\\[A-Za-z]+\s*`)
+
+var bibAccents = map[string]string{"`": "̀", "'": "́", "^": "̂", "~": "̃", "=": "̄", ".": "̇", `"`: "̈"}
+
+// bibValue 处理字段值中常见的 LaTeX 写法。顶层的花括号替换为 \x01 \x02，
+// 以便作者列表中保留 {Go Team} 这样的整体名字。
+func bibValue(raw string) string {
+	raw = bibAccentRe.ReplaceAllStringFunc(raw, func(m string) string {
+		sub := bibAccentRe.FindStringSubmatch(m)
+		return sub[2] + bibAccents[sub[1]]
+	})
+	raw = strings.NewReplacer(`\&`, "&", `\%`, "%", `\$`, "$", `\_`, "_", `\#`, "#", "---", "—", "--", "–", "~", " ").Replace(raw)
+	raw = bibCommandRe.ReplaceAllString(raw, "")
+	var buf strings.Builder
+	depth := 0
+	for _, r := range raw {
+		switch r {
+		case '{':
+			if depth == 0 {
+				buf.WriteRune('\x01')
+			}
+			depth++
+		case '}':
+			depth--
+			if depth == 0 {
+				buf.WriteRune('\x02')
+			}
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	return norm.NFC.String(buf.String())
+}
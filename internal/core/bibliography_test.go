@@ -0,0 +1,174 @@
+package core
+
+import (
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mdbook-gen/internal/config"
+)
+
+const testBibTeX = `@string{acm = "ACM"}
+@comment{忽略的内容 @book{x, title={y}}}
+@article{pike2012,
+  author  = {Rob Pike and Russ Cox},
+  title   = {{Go} at Google},
+  journal = acm # " Queue",
+  year    = 2012,
+}
+@book(wang2020,
+  author = {王小明},
+  title = "中文书",
+  publisher = {出版社},
+  date = {2020-05-01}
+)
+`
+
+// loadTestBibliography 把 data 写入临时目录中的 name，按配置 c 读取
+func loadTestBibliography(t *testing.T, c config.Config, name, data string) *bibliography {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	c.Bibliography.File = name
+	setConfig(t, c)
+	b, err := loadBibliography(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestParseBibTeX(t *testing.T) {
+	entries, err := parseBibTeX(testBibTeX)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("解析出 %d 条文献，应该是 2 条", len(entries))
+	}
+	tests := []struct {
+		got, want string
+	}{
+		{entries[0].Key, "pike2012"},
+		{entries[0].Title, "Go at Google"},
+		{entries[0].Container, "ACM Queue"},
+		{entries[0].Year, "2012"},
+		{entries[0].shortAuthors(), "Pike & Cox"},
+		{entries[1].Key, "wang2020"},
+		{entries[1].Year, "2020"},
+		{entries[1].format(false), "王小明. <cite>中文书</cite>. 出版社, 2020."},
+	}
+	for _, tt := range tests {
+		if tt.got != tt.want {
+			t.Errorf("%q，应该是 %q", tt.got, tt.want)
+		}
+	}
+}
+
+func TestParseCSLJSON(t *testing.T) {
+	entries, err := parseCSLJSON([]byte(`[{"id": "rfc", "title": "HTTP", "author": [{"literal": "IETF"}],
+		"issued": {"date-parts": [[2022, 6]]}, "collection-title": "RFC", "number": "9110"}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("解析出 %d 条文献，应该是 1 条", len(entries))
+	}
+	if got, want := entries[0].format(false), "IETF. <cite>HTTP</cite>. RFC 9110. 2022."; got != want {
+		t.Errorf("format = %q，应该是 %q", got, want)
+	}
+	if _, err := parseCSLJSON([]byte(`{"id": 1}`)); err == nil {
+		t.Error("格式错误的 CSL-JSON 应该返回错误")
+	}
+}
+
+func TestCitations(t *testing.T) {
+	tests := []struct {
+		name, style, md string
+		want            []string
+	}{
+		{
+			name: "数字格式",
+			md:   "见 [@pike2012, p. 3; @wang2020]。",
+			want: []string{`<span class="citation">[<a href="#ref-pike2012" role="doc-biblioref">1, p. 3</a>, <a href="#ref-wang2020" role="doc-biblioref">2</a>]</span>`,
+				`<li id="ref-pike2012">`},
+		},
+		{
+			name:  "作者-年份格式",
+			style: "author-year",
+			md:    "见 [@pike2012] 和 [-@wang2020]。",
+			want:  []string{">Pike &amp; Cox, 2012</a>", ">2020</a>"},
+		},
+		{
+			name: "链接不是引用",
+			md:   "[@pike2012](https://example.com)",
+			want: []string{`<a href="https://example.com">@pike2012</a>`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := loadTestBibliography(t, config.Config{Bibliography: config.BibliographyConfig{Style: tt.style}}, "refs.bib", testBibTeX)
+			chapters := []Chapter{{Content: template.HTML(renderChapter(source{Lines: strings.Split(tt.md, "\n")}, "1.", false))}}
+			if _, err := b.resolveCitations(chapters); err != nil {
+				t.Fatal(err)
+			}
+			for _, w := range tt.want {
+				if !strings.Contains(string(chapters[0].Content), w) {
+					t.Errorf("输出中没有 %s:\n%s", w, chapters[0].Content)
+				}
+			}
+		})
+	}
+}
+
+func TestUnknownCitationKeys(t *testing.T) {
+	tests := []struct {
+		name, md string
+		errors   []string
+	}{
+		{"一个未定义", "[@nosuch]", []string{"@nosuch"}},
+		{"混在已定义的文献中", "[@pike2012; @missing] 和 [@other]", []string{"@missing", "@other"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := loadTestBibliography(t, config.Config{}, "refs.bib", testBibTeX)
+			chapters := []Chapter{{
+				InputFile: "01.00-intro.md",
+				Content:   template.HTML(renderChapter(source{Lines: []string{tt.md}}, "1.", false)),
+			}}
+			var err error
+			out := captureOutput(t, func() { _, err = b.resolveCitations(chapters) })
+			if err == nil {
+				t.Fatal("引用了未定义的文献应该返回错误")
+			}
+			var want string
+			for _, key := range tt.errors {
+				want += "Error: 01.00-intro.md: 引用了未定义的文献 " + key + "\n"
+				if !strings.Contains(string(chapters[0].Content), key+"?") {
+					t.Errorf("输出中没有 %s?:\n%s", key, chapters[0].Content)
+				}
+			}
+			if out != want {
+				t.Errorf("错误信息:\n%s\n应该是:\n%s", out, want)
+			}
+		})
+	}
+}
+
+func TestReferenceAnchorsEscaped(t *testing.T) {
+	entries, err := parseCSLJSON([]byte(`[{"id": "a\" onclick=\"x", "title": "T", "author": [{"literal": "A"}]}]`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, style := range []string{"", "author-year"} {
+		b := loadTestBibliography(t, config.Config{Bibliography: config.BibliographyConfig{Style: style}}, "refs.bib", testBibTeX)
+		out := b.list([]*bibEntry{entries[0]})
+		if want := `<li id="ref-a&quot; onclick=&quot;x">`; !strings.Contains(out, want) {
+			t.Errorf("%s: 输出中没有 %s:\n%s", style, want, out)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// codeInfo 是代码块 info string 解析后的结果，例如:
+//
+//	```go linenos hl_lines="3-5 9" title="main.go" start=42
+type codeInfo struct {
+	Lang    string
+	LineNos bool
+	HLLines map[int]bool // 要高亮的行，见 highlighted
+	Title   string
+	Start   int
+	Diff    bool
+	Tab     string // 所在标签页的名字，相邻的带 tab 的代码块组成一组
+	Group   string // 标签组的名字，同名的组在页面间共享选中的标签
+
+	pos srcPos // 代码块开头的位置，用于诊断
+}
+
+var codeAttrRe = regexp.MustCompile(`([\w-]+)(?:=("[^"]*"|\S+))?`)
+
+// parseCodeInfo 解析 ``` 之后的 info string，未知属性只给出警告
+func parseCodeInfo(info string, pos srcPos) codeInfo {
+	ci := codeInfo{Lang: "text", Start: 1, pos: pos}
+
+	info = strings.TrimSpace(info)
+	if fields := strings.Fields(info); len(fields) > 0 && !strings.Contains(fields[0], "=") {
+		ci.Lang = fields[0]
+		info = strings.TrimSpace(strings.TrimPrefix(info, fields[0]))
+	}
+	if ci.Lang == "diff" {
+		ci.Diff = true
+	}
+
+	for _, m := range codeAttrRe.FindAllStringSubmatch(info, -1) {
+		key, val := m[1], strings.Trim(m[2], `"`)
+		switch key {
+		case "linenos":
+			ci.LineNos = true
+		case "diff":
+			ci.Diff = true
+		case "title":
+			ci.Title = val
+		case "tab":
+			ci.Tab = val
+		case "group":
+			ci.Group = val
+		case "start":
+			n, err := strconv.Atoi(val)
+			if err != nil {
+				fmt.Printf("Warning: %s: start=%q 不是有效的行号\n", pos, val)
+				continue
+			}
+			ci.Start = n
+			ci.LineNos = true
+		case "hl_lines":
+			ci.HLLines = parseLineSet(val, pos)
+		default:
+			fmt.Printf("Warning: %s: 未知的代码块属性 %q\n", pos, key)
+		}
+	}
+	return ci
+}
+
+// parseLineSet 解析 "3-5 9" 或 "3-5,9" 形式的行号集合
+func parseLineSet(s string, pos srcPos) map[int]bool {
+	set := make(map[int]bool)
+	for _, part := range strings.FieldsFunc(s, func(r rune) bool { return r == ' ' || r == ',' }) {
+		from, to, isRange := strings.Cut(part, "-")
+		a, errA := strconv.Atoi(from)
+		b := a
+		var errB error
+		if isRange {
+			b, errB = strconv.Atoi(to)
+		}
+		if errA != nil || errB != nil || b < a {
+			fmt.Printf("Warning: %s: hl_lines 中的 %q 无法解析\n", pos, part)
+			continue
+		}
+		for n := a; n <= b; n++ {
+			set[n] = true
+		}
+	}
+	return set
+}
+
+// lineMark 是叠加在代码上的一段连续行背景 (高亮行或 diff 的增删行)
+type lineMark struct {
+	Kind  string // "hl", "add", "del"
+	Line  int    // 代码块内从 1 开始的行序号
+	Count int
+}
+
+// highlighted 返回 hl_lines 对应的行序号 (从 0 开始)。hl_lines 按显示的行号 (受 start 影响) 计算；
+// 设置了 start 而没有一行落在显示的行号中时，按代码块内从 1 开始的行序号计算，
+// 这样 start=42 hl_lines="1-3" 也能高亮前三行。两种方式都没有落在代码块中的行时给出提示。
+func (ci codeInfo) highlighted(n int) map[int]bool {
+	if len(ci.HLLines) == 0 {
+		return nil
+	}
+	pick := func(first int) map[int]bool {
+		set := make(map[int]bool)
+		for line := range ci.HLLines {
+			if i := line - first; i >= 0 && i < n {
+				set[i] = true
+			}
+		}
+		return set
+	}
+	set := pick(ci.Start)
+	if len(set) == 0 && ci.Start != 1 {
+		set = pick(1)
+	}
+	if len(set) == 0 {
+		fmt.Printf("Warning: %s: hl_lines 中的行都不在代码块中 (共 %d 行，行号从 %d 开始)\n", ci.pos, n, ci.Start)
+	}
+	return set
+}
+
+func (ci codeInfo) marks(lines []string) []lineMark {
+	var marks []lineMark
+	hl := ci.highlighted(len(lines))
+	for i, line := range lines {
+		kind := ""
+		if hl[i] {
+			kind = "hl"
+		} else if ci.Diff && strings.HasPrefix(line, "+") && !strings.HasPrefix(line, "+++") {
+			kind = "add"
+		} else if ci.Diff && strings.HasPrefix(line, "-") && !strings.HasPrefix(line, "---") {
+			kind = "del"
+		}
+		if kind == "" {
+			continue
+		}
+		if n := len(marks); n > 0 && marks[n-1].Kind == kind && marks[n-1].Line+marks[n-1].Count == i+1 {
+			marks[n-1].Count++
+			continue
+		}
+		marks = append(marks, lineMark{Kind: kind, Line: i + 1, Count: 1})
+	}
+	return marks
+}
+
+// renderFence 输出一个围栏代码块，mermaid 图表原样交给客户端渲染
+func renderFence(ci codeInfo, fileName string, lines []string) string {
+	switch ci.Lang {
+	case "mermaid":
+		return "<div class=\"mermaid\">\n" + escapeHTML(strings.Join(lines, "\n")) + "\n</div>\n"
+	case "console", "shell-session":
+		return renderConsoleBlock(ci, lines)
+	}
+	return renderCodeBlock(ci, fileName, lines)
+}
+
+// renderConsoleBlock 把终端会话输出为 figure.bash:
+// 以 "$ " 开头的行是命令 (行尾 \ 表示下一行仍属于该命令)，其余行是输出，包在 <samp> 里。
+// 提示符单独放在 span.prompt 中，复制按钮只复制 span.command 的内容。
+func renderConsoleBlock(ci codeInfo, lines []string) string {
+	var buf bytes.Buffer
+	buf.WriteString("<figure class=\"bash\">\n")
+	if ci.Title != "" {
+		buf.WriteString(fmt.Sprintf("<figcaption>%s</figcaption>\n", escapeHTML(ci.Title)))
+	}
+	// nohighlight: 避免 highlight.js 用纯文本重写 <code> 而丢掉命令/输出的区分
+	buf.WriteString("<pre><code class=\"nohighlight\">")
+
+	continued := false
+	for _, line := range lines {
+		switch {
+		case continued:
+			buf.WriteString(fmt.Sprintf("<span class=\"command\">%s</span>\n", escapeHTML(line)))
+		case strings.HasPrefix(line, "$ ") || line == "$":
+			line = strings.TrimPrefix(strings.TrimPrefix(line, "$"), " ")
+			buf.WriteString(fmt.Sprintf("<span class=\"prompt\">$ </span><span class=\"command\">%s</span>\n", escapeHTML(line)))
+		default:
+			buf.WriteString(fmt.Sprintf("<samp>%s</samp>\n", escapeHTML(line)))
+			continue
+		}
+		continued = strings.HasSuffix(line, "\\")
+	}
+
+	buf.WriteString("</code></pre>\n</figure>\n")
+	return buf.String()
+}
+
+// renderCodeBlock 输出 figure.code 结构。
+// 行号和行背景都放在 <code> 之外，这样客户端的 highlight.js 仍然可以直接处理 <code> 的文本。
+func renderCodeBlock(ci codeInfo, fileName string, lines []string) string {
+	var buf bytes.Buffer
+
+	class := "code " + escapeAttr(ci.Lang)
+	if ci.LineNos {
+		class += " linenos"
+	}
+	if ci.Diff {
+		class += " diff"
+	}
+	buf.WriteString(fmt.Sprintf("<figure class=\"%s\">\n", class))
+	if ci.Title != "" {
+		buf.WriteString(fmt.Sprintf("<figcaption>%s</figcaption>\n", escapeHTML(ci.Title)))
+	} else if fileName != "" {
+		buf.WriteString(fmt.Sprintf("<figcaption>File: %s</figcaption>\n", escapeHTML(fileName)))
+	}
+
+	var code bytes.Buffer
+	code.WriteString(fmt.Sprintf("<code class=\"language-%s\">", escapeAttr(ci.Lang)))
+	for _, line := range lines {
+		code.WriteString(escapeHTML(line) + "\n")
+	}
+	code.WriteString("</code>")
+
+	marks := ci.marks(lines)
+	if !ci.LineNos && len(marks) == 0 {
+		buf.WriteString("<pre>" + code.String() + "</pre>\n</figure>\n")
+		return buf.String()
+	}
+
+	buf.WriteString("<div class=\"code-body\">\n")
+	if ci.LineNos {
+		buf.WriteString("<div class=\"gutter\" aria-hidden=\"true\">")
+		for i := range lines {
+			buf.WriteString(strconv.Itoa(ci.Start+i) + "\n")
+		}
+		buf.WriteString("</div>\n")
+	}
+	// 行背景和代码放在同一个 .code-lines 中，宽度随最长的一行，横向滚动时一起移动
+	buf.WriteString("<pre><span class=\"code-lines\">" + code.String())
+	for _, m := range marks {
+		buf.WriteString(fmt.Sprintf("<span class=\"mark %s\" style=\"--line:%d;--count:%d\" aria-hidden=\"true\"></span>", m.Kind, m.Line, m.Count))
+	}
+	buf.WriteString("</span></pre>\n</div>\n</figure>\n")
+	return buf.String()
+}
+
+// isTabFence 判断一行是否是带 tab 属性的代码块开头。
+// 和 parseCodeInfo 一样按属性解析，title="see tab=2" 这样引号中的 tab= 不算；
+// 这里不调用 parseCodeInfo，以免未知属性的警告输出两次。
+func isTabFence(line string) bool {
+	if !strings.HasPrefix(line, "```") {
+		return false
+	}
+	for _, m := range codeAttrRe.FindAllStringSubmatch(strings.TrimPrefix(line, "```"), -1) {
+		if m[1] == "tab" && strings.Trim(m[2], `"`) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// codeTab 是标签组中的一页
+type codeTab struct {
+	Label string
+	HTML  string
+}
+
+// renderTabGroup 把连续的带 tab 的代码块输出为一组。
+// 输出的是依次排列、各带一个 .tab-label 标签的代码块，不依赖脚本和样式，
+// 在 EPUB、打印和关闭了脚本的浏览器中都能看；页面中的脚本再把它变成标签页。
+func renderTabGroup(group string, tabs []codeTab) string {
+	if group == "" {
+		labels := make([]string, len(tabs))
+		for i, t := range tabs {
+			labels[i] = t.Label
+		}
+		sort.Strings(labels)
+		group = strings.Join(labels, "|")
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("<div class=\"tabs\" data-group=\"%s\">\n", escapeAttr(group)))
+	for _, t := range tabs {
+		buf.WriteString(fmt.Sprintf("<div class=\"tab-panel\" data-label=\"%s\">\n", escapeAttr(t.Label)))
+		buf.WriteString(fmt.Sprintf("<p class=\"tab-label\">%s</p>\n", escapeHTML(t.Label)))
+		buf.WriteString(t.HTML)
+		buf.WriteString("</div>\n")
+	}
+	buf.WriteString("</div>\n")
+	return buf.String()
+}
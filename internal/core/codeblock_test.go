@@ -0,0 +1,197 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"mdbook-gen/internal/config"
+)
+
+func TestCodeBlockEscapesFileNameAndLang(t *testing.T) {
+	tests := []struct {
+		name, md, bad, want string
+	}{
+		{
+			name: "文件名注释",
+			md:   "```go\n// <svg/onload=alert(1)>\nfmt.Println()\n```",
+			bad:  "<svg",
+			want: "<figcaption>File: &lt;svg/onload=alert(1)&gt;</figcaption>",
+		},
+		{
+			name: "语言",
+			md:   "```go\"><b>x</b>\nfmt.Println()\n```",
+			bad:  "<b>",
+			want: `<code class="language-go&quot;&gt;&lt;b&gt;x&lt;/b&gt;">`,
+		},
+	}
+	for _, tt := range tests {
+		for _, raw := range []string{"allow", "escape", "sanitize"} {
+			t.Run(tt.name+"/"+raw, func(t *testing.T) {
+				out := renderMarkdown(t, config.Config{HTML: config.HTMLConfig{Raw: raw}}, tt.md)
+				if strings.Contains(out, tt.bad) {
+					t.Errorf("输出中有未转义的标签:\n%s", out)
+				}
+				if !strings.Contains(out, tt.want) {
+					t.Errorf("输出中没有 %s:\n%s", tt.want, out)
+				}
+			})
+		}
+	}
+}
+
+func TestTabGroups(t *testing.T) {
+	tests := []struct {
+		name, md string
+		want     []string // 按顺序出现
+	}{
+		{
+			name: "相邻的标签页",
+			md:   "```go tab=Go\na\n```\n```python tab=Python\nb\n```\n\n正文",
+			want: []string{`<div class="tabs" data-group="Go|Python">`, `data-label="Go"`, `data-label="Python"`, "<p>正文</p>"},
+		},
+		{
+			name: "指定 group",
+			md:   "```console tab=Linux group=os\n$ ls\n```\n\n```console tab=Windows\n> dir\n```",
+			want: []string{`<div class="tabs" data-group="os">`,
+				`<div class="tab-panel" data-label="Linux">`, `<p class="tab-label">Linux</p>`, "ls",
+				`<div class="tab-panel" data-label="Windows">`, `<p class="tab-label">Windows</p>`, "dir"},
+		},
+		{
+			name: "没有 group 时按标签排序",
+			md:   "```sh tab=\"macOS\"\na\n```\n```sh tab=\"Linux\"\nb\n```",
+			want: []string{`<div class="tabs" data-group="Linux|macOS">`,
+				`<div class="tab-panel" data-label="macOS">`, `<p class="tab-label">macOS</p>`,
+				`<div class="tab-panel" data-label="Linux">`, `<p class="tab-label">Linux</p>`},
+		},
+		{
+			name: "最后一页没有闭合",
+			md:   "```go tab=Go\na\n```\n```python tab=Python\nb",
+			want: []string{`<div class="tabs"`, `data-label="Go"`, `data-label="Python"`, "b\n</code>", "</div>\n</div>\n"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out string
+			captureOutput(t, func() { out = renderMarkdown(t, config.Config{}, tt.md) })
+			rest := out
+			for _, w := range tt.want {
+				i := strings.Index(rest, w)
+				if i < 0 {
+					t.Fatalf("输出中 %q 缺失或顺序不对:\n%s", w, out)
+				}
+				rest = rest[i+len(w):]
+			}
+			if strings.Count(out, "<figure") != 2 {
+				t.Errorf("应该有 2 个代码块:\n%s", out)
+			}
+			// 输出的是依次排列的代码块，标签栏由页面中的脚本生成
+			if strings.Contains(out, "hidden") || strings.Contains(out, "tab-list") {
+				t.Errorf("所有页都应该直接显示:\n%s", out)
+			}
+		})
+	}
+}
+
+func TestTabAttributeInOtherValue(t *testing.T) {
+	md := "```go tab=Go\na\n```\n```go title=\"see tab=2\"\nb\n```"
+	out := renderMarkdown(t, config.Config{}, md)
+	if strings.Count(out, `class="tab-panel"`) != 1 {
+		t.Errorf("只有第一个代码块是标签页:\n%s", out)
+	}
+	if i := strings.Index(out, "</div>\n</div>\n"); i < 0 || !strings.Contains(out[i:], "see tab=2") {
+		t.Errorf("第二个代码块应该在标签组后面:\n%s", out)
+	}
+}
+
+func TestIsTabFence(t *testing.T) {
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{"```go tab=Go", true},
+		{"```go tab=\"Go 1.22\" group=go", true},
+		{"```tab=Linux", true},
+		{"```go title=\"see tab=2\"", false},
+		{"```go mytab=2", false},
+		{"```go tab=\"\"", false},
+		{"```go", false},
+		{"text tab=Go", false},
+	}
+	for _, tt := range tests {
+		if got := isTabFence(tt.line); got != tt.want {
+			t.Errorf("isTabFence(%q) = %v，应该是 %v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestParseLineSet(t *testing.T) {
+	tests := []struct {
+		spec    string
+		want    []int
+		warning string
+	}{
+		{"3", []int{3}, ""},
+		{"3-5 9", []int{3, 4, 5, 9}, ""},
+		{"3-5,9", []int{3, 4, 5, 9}, ""},
+		{" 1 , 2 ", []int{1, 2}, ""},
+		{"5-3 x 7", []int{7}, "Warning: a.md:1: hl_lines 中的 \"5-3\" 无法解析\nWarning: a.md:1: hl_lines 中的 \"x\" 无法解析\n"},
+		{"", nil, ""},
+	}
+	for _, tt := range tests {
+		var set map[int]bool
+		out := captureOutput(t, func() { set = parseLineSet(tt.spec, srcPos{"a.md", 1}) })
+		var got []int
+		for n := 0; n <= 10; n++ {
+			if set[n] {
+				got = append(got, n)
+			}
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("parseLineSet(%q) = %v，应该是 %v", tt.spec, got, tt.want)
+		}
+		if out != tt.warning {
+			t.Errorf("parseLineSet(%q) 的警告 %q，应该是 %q", tt.spec, out, tt.warning)
+		}
+	}
+}
+
+func TestCodeMarks(t *testing.T) {
+	lines := []string{"--- a/x.go", "+++ b/x.go", "@@ -1,3 +1,3 @@", "-old", "-old2", "+new", " same", "+new2"}
+	tests := []struct {
+		name, info string
+		lines      []string
+		want       string
+		warning    bool
+	}{
+		{"相邻的行合并", `go hl_lines="2-3 5"`, []string{"a", "b", "c", "d", "e"}, "[{hl 2 2} {hl 5 1}]", false},
+		{"显示的行号", `go start=42 hl_lines="43-44"`, []string{"a", "b", "c"}, "[{hl 2 2}]", false},
+		{"start 之后按块内行序号", `go start=42 hl_lines="1-3"`, []string{"a", "b", "c"}, "[{hl 1 3}]", false},
+		{"超出范围", `go start=42 hl_lines="10"`, []string{"a", "b", "c"}, "[]", true},
+		{"diff 不包括文件头", "diff", lines, "[{del 4 2} {add 6 1} {add 8 1}]", false},
+		{"高亮优先于 diff", `diff hl_lines="4"`, lines, "[{hl 4 1} {del 5 1} {add 6 1} {add 8 1}]", false},
+		{"不是 diff", "go", lines, "[]", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ci := parseCodeInfo(tt.info, srcPos{"a.md", 1})
+			var marks []lineMark
+			out := captureOutput(t, func() { marks = ci.marks(tt.lines) })
+			if got := fmt.Sprint(marks); got != tt.want {
+				t.Errorf("marks = %s，应该是 %s", got, tt.want)
+			}
+			if strings.Contains(out, "hl_lines 中的行都不在代码块中") != tt.warning {
+				t.Errorf("警告: %q", out)
+			}
+		})
+	}
+}
+
+func TestCodeMarksInsideScroller(t *testing.T) {
+	out := renderMarkdown(t, config.Config{}, "```go hl_lines=\"1\"\nfmt.Println()\n```")
+	want := `<pre><span class="code-lines"><code class="language-go">fmt.Println()` + "\n" +
+		`</code><span class="mark hl" style="--line:1;--count:1" aria-hidden="true"></span></span></pre>`
+	if !strings.Contains(out, want) {
+		t.Errorf("行背景应该和代码在同一个 .code-lines 中:\n%s", out)
+	}
+}
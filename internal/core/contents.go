@@ -0,0 +1,103 @@
+package core
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+)
+
+// addContentsPages 补上缺少的目录页和封面: 页眉页脚总是链接到目录页，
+// index.html 默认是前言，没有 00.00-frontmatter.md 时按 contents.landing 生成。
+func addContentsPages(chapters []Chapter) []Chapter {
+	hasFront, hasContents := false, false
+	for _, ch := range chapters {
+		hasFront = hasFront || ch.IsFront
+		hasContents = hasContents || ch.IsContents
+	}
+
+	if !hasFront {
+		switch conf.Contents.Landing {
+		case "", "cover":
+			cover := Chapter{
+				ID:         "00.00-front-matter",
+				Title:      "封面",
+				OutputFile: "00.00-front-matter.html",
+				Content:    renderCover(chapters),
+				IsFront:    true,
+			}
+			chapters = append([]Chapter{cover}, chapters...)
+		case "contents":
+			// index.html 使用目录页
+		default:
+			fmt.Printf("Warning: 未知的 contents.landing 设置 %q，可选 cover 或 contents\n", conf.Contents.Landing)
+		}
+	}
+	if hasContents {
+		return chapters
+	}
+
+	// 目录页放在前言 (或封面) 后面
+	at := 0
+	for i, ch := range chapters {
+		if ch.IsFront {
+			at = i + 1
+		}
+	}
+	contents := Chapter{
+		ID:         "00.01-contents",
+		Title:      "目录",
+		OutputFile: "00.01-contents.html",
+		IsContents: true,
+	}
+	return append(chapters[:at], append([]Chapter{contents}, chapters[at:]...)...)
+}
+
+// landingPage 返回复制为 index.html 的页面
+func landingPage(chapters []Chapter) string {
+	landing := ""
+	for _, ch := range chapters {
+		if ch.IsFront {
+			return ch.OutputFile
+		}
+		if ch.IsContents {
+			landing = ch.OutputFile
+		}
+	}
+	return landing
+}
+
+// renderCover 生成没有前言时的封面: 书名、作者和开始阅读的链接
+func renderCover(chapters []Chapter) template.HTML {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("<div class=\"cover\">\n<h1 id=\"cover\">%s</h1>\n", escapeHTML(conf.Title)))
+	if conf.Author != "" {
+		b.WriteString(fmt.Sprintf("<p class=\"cover-author\">%s</p>\n", escapeHTML(conf.Author)))
+	}
+	b.WriteString("<p class=\"cover-links\">")
+	for _, ch := range chapters {
+		if !ch.IsContents && ch.Number != "" {
+			b.WriteString(fmt.Sprintf(`<a href="%s">开始阅读</a> &middot; `, pageHref(ch.OutputFile)))
+			break
+		}
+	}
+	b.WriteString(fmt.Sprintf("<a href=\"%s\">目录</a></p>\n", pageHref("00.01-contents.html")))
+	if conf.Copyright != "" {
+		b.WriteString(fmt.Sprintf("<p class=\"cover-copyright\">%s</p>\n", escapeHTML(conf.Copyright)))
+	}
+	b.WriteString("</div>\n")
+	return template.HTML(b.String())
+}
+
+// contentsIntro 把 00.01-contents.md 去掉一级标题后作为目录上方的说明文字
+func contentsIntro(src source) source {
+	for i, line := range src.Lines {
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "# ") {
+			return source{Lines: src.Lines[i+1:], Pos: src.Pos[i+1:]}
+		}
+		break
+	}
+	return src
+}
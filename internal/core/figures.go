@@ -0,0 +1,220 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"html/template"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"mdbook-gen/internal/config"
+)
+
+var (
+	// ![alt](src "标题"){#fig:标签}
+	imageRe = regexp.MustCompile(`!\[([^\]]*)\]\(([^\s()]+(?:\([^\s()]*\)[^\s()]*)*)(?:\s+"([^"]*)")?\)(?:\{#((?:fig:)?[\w.-]+)\})?`)
+	// @fig:标签 / @tbl:标签 / @sec:标签，前面不能是字母数字，避免误认邮箱地址
+	xrefRe = regexp.MustCompile(`(^|[^\w@.])@((?:fig|tbl|sec):[\w.-]*[\w])`)
+	// Table: 标题 {#tbl:标签}，也接受 "表：" 和 ":"
+	tableCaptionRe = regexp.MustCompile(`^(?:Table:|表[:：]|:)\s*(.*?)\s*(?:\{#((?:tbl:)?[\w.-]+)\})?$`)
+
+	// renderImage / renderTable 输出的待编号标记
+	numberedMarkRe = regexp.MustCompile(`<figure class="img" data-fig="([^"]*)">(.*?)<figcaption><span class="caption-label"></span>(.*?)</figcaption>|<table data-tbl="([^"]*)">\n<caption><span class="caption-label"></span>(.*?)</caption>`)
+	xrefMarkRe     = regexp.MustCompile(`<a class="xref" data-ref="([^"]*)"></a>`)
+)
+
+// renderImage 输出图片。没有标题和标签的图片保持原来的样式，
+// 其余的输出带 figcaption 的编号图片，编号由 numberFigures 统一填写。
+func renderImage(m []string) string {
+	alt, src, title, label := escapeAttr(m[1]), pageHref(escapeAttr(safeURL(m[2], true))), m[3], m[4]
+	if title == "" && label == "" {
+		return fmt.Sprintf(`<figure class="img"><img src="%s" alt="%s"></figure>`, src, alt)
+	}
+	if label != "" && !strings.HasPrefix(label, "fig:") {
+		label = "fig:" + label
+	}
+	return fmt.Sprintf(`<figure class="img" data-fig="%s"><img src="%s" alt="%s"><figcaption><span class="caption-label"></span>%s</figcaption></figure>`,
+		label, src, alt, processInline(title))
+}
+
+// parseTableCaption 解析表格后面的标题行
+func parseTableCaption(line string) (caption, label string, ok bool) {
+	m := tableCaptionRe.FindStringSubmatch(line)
+	if m == nil {
+		return "", "", false
+	}
+	label = m[2]
+	if label != "" && !strings.HasPrefix(label, "tbl:") {
+		label = "tbl:" + label
+	}
+	return m[1], label, true
+}
+
+// numberedItem 是一个编号的图片或表格，也用于 {#sec:标签} 标题的交叉引用
+type numberedItem struct {
+	Kind    string // "fig"、"tbl" 或 "sec"
+	Label   string
+	Number  string        // 例如 "3.2"
+	Caption template.HTML // 不含编号的标题
+	Anchor  string
+	Page    string // 所在页面的输出文件名
+}
+
+// figuresConf 返回 figures 设置，没有设置的文字使用默认值
+func figuresConf() config.FiguresConfig {
+	f := conf.Figures
+	if f.FigureLabel == "" {
+		f.FigureLabel = "图"
+	}
+	if f.TableLabel == "" {
+		f.TableLabel = "表"
+	}
+	if f.FigureListTitle == "" {
+		f.FigureListTitle = "插图目录"
+	}
+	if f.TableListTitle == "" {
+		f.TableListTitle = "表格目录"
+	}
+	return f
+}
+
+// Title 返回引用时显示的 HTML，例如 "图 3.2"、"第 3.1 节"
+func (it numberedItem) Title() string {
+	if it.Kind == "sec" {
+		// 没有编号的标题用标题文字
+		if it.Number == "" {
+			return string(it.Caption)
+		}
+		label := conf.Headings.SectionLabel
+		if label == "" {
+			label = "第 %s 节"
+		}
+		if !strings.Contains(label, "%s") {
+			label += " %s" // 和 figure_label 一样只写了前缀，例如 "Section"
+		}
+		return escapeHTML(strings.Replace(label, "%s", it.Number, 1))
+	}
+	name := figuresConf().FigureLabel
+	if it.Kind == "tbl" {
+		name = figuresConf().TableLabel
+	}
+	return escapeHTML(name + " " + it.Number)
+}
+
+// numberFigures 按全书顺序给图片和表格编号。
+// 编号以章号为前缀 (图 3.2)，同一章的子章节文件连续计数；前言等没有章号的页面从 1 开始。
+// 之后解析所有 @fig: / @tbl: / @sec: 交叉引用。
+func numberFigures(chapters []Chapter) []numberedItem {
+	var items []numberedItem
+	byLabel := make(map[string]numberedItem)
+	counters := make(map[string]int) // "3/fig" -> 已用的编号
+
+	for i := range chapters {
+		ch := &chapters[i]
+		prefix := ""
+		if ch.Number != "" {
+			prefix = strings.SplitN(ch.Number, ".", 2)[0] + "."
+		}
+		ch.Content = template.HTML(numberedMarkRe.ReplaceAllStringFunc(string(ch.Content), func(mark string) string {
+			m := numberedMarkRe.FindStringSubmatch(mark)
+			it := numberedItem{Kind: "fig", Label: m[1], Caption: template.HTML(m[3]), Page: ch.OutputFile}
+			if m[4] != "" || strings.HasPrefix(mark, "<table") {
+				it = numberedItem{Kind: "tbl", Label: m[4], Caption: template.HTML(m[5]), Page: ch.OutputFile}
+			}
+			key := prefix + "/" + it.Kind
+			counters[key]++
+			it.Number = fmt.Sprintf("%s%d", prefix, counters[key])
+			it.Anchor = it.Kind + "-" + strings.ReplaceAll(it.Number, ".", "-")
+			if it.Label != "" {
+				it.Anchor = strings.ReplaceAll(it.Label, ":", "-")
+				if _, dup := byLabel[it.Label]; dup {
+					fmt.Printf("Warning: %s: 标签 %s 重复定义\n", chapterDisplayPath(*ch), it.Label)
+				}
+				byLabel[it.Label] = it
+			}
+			items = append(items, it)
+
+			label := fmt.Sprintf(`<span class="caption-label">%s</span>`, it.Title())
+			if it.Caption != "" {
+				label += " "
+			}
+			if it.Kind == "fig" {
+				return fmt.Sprintf(`<figure class="img numbered" id="%s">%s<figcaption>%s%s</figcaption>`, it.Anchor, m[2], label, m[3])
+			}
+			return fmt.Sprintf("<table id=\"%s\">\n<caption>%s%s</caption>", it.Anchor, label, m[5])
+		}))
+	}
+
+	// ID 为 sec:标签 的标题
+	for _, ch := range chapters {
+		for _, h := range ch.headings {
+			if !strings.HasPrefix(h.ID, "sec:") {
+				continue
+			}
+			if _, dup := byLabel[h.ID]; dup {
+				fmt.Printf("Warning: %s: 标签 %s 重复定义\n", chapterDisplayPath(ch), h.ID)
+			}
+			byLabel[h.ID] = numberedItem{Kind: "sec", Label: h.ID, Number: h.Number, Caption: template.HTML(headingTitle(h.Text)), Anchor: h.ID, Page: ch.OutputFile}
+		}
+	}
+
+	for i := range chapters {
+		ch := &chapters[i]
+		ch.Content = template.HTML(xrefMarkRe.ReplaceAllStringFunc(string(ch.Content), func(mark string) string {
+			label := xrefMarkRe.FindStringSubmatch(mark)[1]
+			it, ok := byLabel[label]
+			if !ok {
+				fmt.Printf("Warning: %s: 找不到交叉引用的目标 @%s\n", chapterDisplayPath(*ch), label)
+				return "@" + escapeHTML(label)
+			}
+			href := "#" + it.Anchor
+			if it.Page != ch.OutputFile {
+				href = pageHref(it.Page + href)
+			}
+			return fmt.Sprintf(`<a class="xref" href="%s">%s</a>`, href, it.Title())
+		}))
+	}
+	return items
+}
+
+// chapterDisplayPath 返回章节源文件相对书籍目录的路径，用于诊断信息
+func chapterDisplayPath(ch Chapter) string {
+	if pos := ch.src.posAt(0); pos.File != "" {
+		return pos.File
+	}
+	return filepath.Base(ch.InputFile)
+}
+
+// figureListPages 生成插图目录和表格目录页面，放在最后一章之后
+func figureListPages(items []numberedItem) []Chapter {
+	if conf.Figures.HideLists {
+		return nil
+	}
+	var pages []Chapter
+	for _, kind := range []string{"fig", "tbl"} {
+		var buf bytes.Buffer
+		count := 0
+		for _, it := range items {
+			if it.Kind != kind {
+				continue
+			}
+			count++
+			buf.WriteString(fmt.Sprintf("<li><a href=\"%s\">%s %s</a></li>\n", pageHref(it.Page+"#"+it.Anchor), it.Title(), it.Caption))
+		}
+		if count == 0 {
+			continue
+		}
+		title, id := figuresConf().FigureListTitle, "list-of-figures"
+		if kind == "tbl" {
+			title, id = figuresConf().TableListTitle, "list-of-tables"
+		}
+		pages = append(pages, Chapter{
+			ID:         id,
+			Title:      title,
+			OutputFile: id + ".html",
+			Content:    template.HTML(fmt.Sprintf("<h1 id=\"%s\">%s</h1>\n\n<nav class=\"figure-list\">\n<ol>\n%s</ol>\n</nav>\n", id, escapeHTML(title), buf.String())),
+		})
+	}
+	return pages
+}
@@ -0,0 +1,143 @@
+package core
+
+import (
+	"fmt"
+	"html/template"
+	"strings"
+	"testing"
+
+	"mdbook-gen/internal/config"
+)
+
+func TestFigureListTitles(t *testing.T) {
+	items := []numberedItem{
+		{Kind: "fig", Label: "fig:a", Number: "1.1", Anchor: "fig-1-1", Page: "01.00-a.html"},
+		{Kind: "tbl", Label: "tbl:b", Number: "1.1", Anchor: "tbl-1-1", Page: "01.00-a.html"},
+	}
+	tests := []struct {
+		figures  config.FiguresConfig
+		fig, tbl string
+	}{
+		{config.FiguresConfig{}, "插图目录", "表格目录"},
+		{config.FiguresConfig{FigureLabel: "Figure", TableLabel: "Table", FigureListTitle: "List of Figures", TableListTitle: "List of Tables"}, "List of Figures", "List of Tables"},
+	}
+	for _, tt := range tests {
+		setConfig(t, config.Config{Figures: tt.figures})
+		pages := figureListPages(items)
+		if len(pages) != 2 {
+			t.Fatalf("生成了 %d 个目录页面", len(pages))
+		}
+		if pages[0].Title != tt.fig || pages[1].Title != tt.tbl {
+			t.Errorf("目录标题为 %q、%q，应该是 %q、%q", pages[0].Title, pages[1].Title, tt.fig, tt.tbl)
+		}
+	}
+}
+
+// renderTestChapters 把每段 Markdown 渲染成一章，章号依次为 1.、2.……
+func renderTestChapters(t *testing.T, c config.Config, mds ...string) []Chapter {
+	t.Helper()
+	setConfig(t, c)
+	var chapters []Chapter
+	for i, md := range mds {
+		number := fmt.Sprintf("%d.", i+1)
+		src := testSource(md)
+		chapters = append(chapters, Chapter{
+			Number:     number,
+			OutputFile: fmt.Sprintf("%02d.00-ch.html", i+1),
+			Content:    template.HTML(renderChapter(src, number, false)),
+			src:        src,
+			headings:   chapterHeadings.list,
+		})
+	}
+	return chapters
+}
+
+func TestNumberFigures(t *testing.T) {
+	chapters := renderTestChapters(t, config.Config{},
+		"![甲](a.png \"第一张\"){#fig:a}\n\n![乙](b.png \"第二张\")\n\n| a |\n| - |\n| 1 |\n\nTable: 数据 {#tbl:data}",
+		"![丙](c.png \"第三张\")\n\n见 @fig:a 和 @tbl:data。",
+	)
+	items := numberFigures(chapters)
+
+	var got []string
+	for _, it := range items {
+		got = append(got, it.Kind+" "+it.Number+" "+it.Anchor)
+	}
+	want := []string{"fig 1.1 fig-a", "fig 1.2 fig-1-2", "tbl 1.1 tbl-data", "fig 2.1 fig-2-1"}
+	if strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("编号为 %q，应该是 %q", got, want)
+	}
+	for i, w := range [][]string{
+		{`<figure class="img numbered" id="fig-a">`, `<figcaption><span class="caption-label">图 1.1</span> 第一张</figcaption>`, `<caption><span class="caption-label">表 1.1</span> 数据</caption>`},
+		{`<span class="caption-label">图 2.1</span>`, "<a class=\"xref\" href=\"\x0301.00-ch.html#fig-a\x04\">图 1.1</a>", "<a class=\"xref\" href=\"\x0301.00-ch.html#tbl-data\x04\">表 1.1</a>"},
+	} {
+		for _, s := range w {
+			if !strings.Contains(string(chapters[i].Content), s) {
+				t.Errorf("第 %d 章输出中没有 %q:\n%s", i+1, s, chapters[i].Content)
+			}
+		}
+	}
+}
+
+func TestFigureLabelsEscaped(t *testing.T) {
+	chapters := renderTestChapters(t, config.Config{Figures: config.FiguresConfig{FigureLabel: "<b>Fig</b>", TableLabel: "R&D"}},
+		"![甲](a.png \"标题\"){#fig:a}\n\n| a |\n| - |\n| 1 |\n\nTable: 数据\n\n见 @fig:a。",
+	)
+	items := numberFigures(chapters)
+	content := string(chapters[0].Content)
+	for _, s := range []string{`<span class="caption-label">&lt;b&gt;Fig&lt;/b&gt; 1.1</span>`, `<span class="caption-label">R&amp;D 1.1</span>`, `>&lt;b&gt;Fig&lt;/b&gt; 1.1</a>`} {
+		if !strings.Contains(content, s) {
+			t.Errorf("输出中没有 %q:\n%s", s, content)
+		}
+	}
+	if strings.Contains(content, "<b>Fig") {
+		t.Errorf("输出中有未转义的标签:\n%s", content)
+	}
+	for _, page := range figureListPages(items) {
+		if strings.Contains(string(page.Content), "<b>") || strings.Contains(string(page.Content), "R&D") {
+			t.Errorf("%s 中有未转义的标签:\n%s", page.Title, page.Content)
+		}
+	}
+	if conf.Figures.FigureListTitle != "" {
+		t.Errorf("numberFigures 修改了配置: %+v", conf.Figures)
+	}
+}
+
+func TestSectionRefs(t *testing.T) {
+	var chapters []Chapter
+	warnings := captureOutput(t, func() {
+		chapters = renderTestChapters(t, config.Config{},
+			"## 使用 `go vet` {#sec:vet}\n\n见 @sec:vet、@sec:nosuch 和 @fig:nosuch。",
+		)
+		numberFigures(chapters)
+	})
+	content := string(chapters[0].Content)
+	for _, s := range []string{`<a class="xref" href="#sec:vet">使用 go vet</a>`, "、@sec:nosuch 和 @fig:nosuch。"} {
+		if !strings.Contains(content, s) {
+			t.Errorf("输出中没有 %q:\n%s", s, content)
+		}
+	}
+	want := "Warning: test.md: 找不到交叉引用的目标 @sec:nosuch\nWarning: test.md: 找不到交叉引用的目标 @fig:nosuch\n"
+	if warnings != want {
+		t.Errorf("警告 %q，应该是 %q", warnings, want)
+	}
+}
+
+func TestSectionRefTitle(t *testing.T) {
+	tests := []struct {
+		label, number, want string
+	}{
+		{"", "3.1", "第 3.1 节"},
+		{"Section %s", "3.1", "Section 3.1"},
+		{"Section", "3.1", "Section 3.1"},
+		{"§%s", "2.4", "§2.4"},
+		{"Section %s", "", "安装"},
+	}
+	for _, tt := range tests {
+		setConfig(t, config.Config{Headings: config.HeadingsConfig{SectionLabel: tt.label}})
+		it := numberedItem{Kind: "sec", Number: tt.number, Caption: template.HTML("安装")}
+		if got := it.Title(); got != tt.want {
+			t.Errorf("section_label %q: Title() = %q，应该是 %q", tt.label, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,180 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// [^id]: 定义，必须顶格书写
+	footnoteDefRe = regexp.MustCompile(`^\[\^([^\]\s"<>]+)\]:\s?(.*)$`)
+	// [^id] 引用
+	footnoteRefRe = regexp.MustCompile(`\[\^([^\]\s"<>]+)\]`)
+	// processInline 为引用生成的占位标记，编号在整章渲染完之后统一分配
+	footnoteMarkRe = regexp.MustCompile(`<sup class="footnote-ref" data-fn="([^"]+)"></sup>`)
+)
+
+// extractFootnotes 从章节中取出所有脚注定义，返回去掉定义后的正文和定义内容。
+// 定义的后续行需要缩进 4 个空格或一个 Tab，中间可以有空行，从而支持多段落的脚注。
+func extractFootnotes(src source) (source, map[string]source) {
+	var body source
+	defs := make(map[string]source)
+	refs := make(map[string]srcPos) // 每个引用第一次出现的位置，用于诊断
+	var refOrder, defOrder []string // 按出现顺序输出警告
+	addRefs := func(line string, pos srcPos) {
+		// 行内代码中的 [^id] 不是引用
+		line = replaceCodeSpans(line, func(string) string { return "" })
+		for _, r := range footnoteRefRe.FindAllStringSubmatch(line, -1) {
+			if _, seen := refs[r[1]]; !seen {
+				refs[r[1]] = pos
+				refOrder = append(refOrder, r[1])
+			}
+		}
+	}
+
+	inFence := false
+	for i := 0; i < len(src.Lines); i++ {
+		line := src.Lines[i]
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+		}
+		m := footnoteDefRe.FindStringSubmatch(line)
+		if inFence || m == nil {
+			if !inFence {
+				addRefs(line, src.posAt(i))
+			}
+			body.Lines = append(body.Lines, line)
+			body.Pos = append(body.Pos, src.posAt(i))
+			continue
+		}
+
+		id := m[1]
+		if _, dup := defs[id]; dup {
+			fmt.Printf("Warning: %s: 脚注 [^%s] 重复定义，使用后一个\n", src.posAt(i), id)
+		} else {
+			defOrder = append(defOrder, id)
+		}
+		def := source{Lines: []string{m[2]}, Pos: []srcPos{src.posAt(i)}}
+		for i+1 < len(src.Lines) {
+			next := src.Lines[i+1]
+			if strings.TrimSpace(next) == "" {
+				// 空行之后仍有缩进内容才算同一个脚注
+				j := i + 1
+				for j < len(src.Lines) && strings.TrimSpace(src.Lines[j]) == "" {
+					j++
+				}
+				if j >= len(src.Lines) || !isFootnoteContinuation(src.Lines[j]) {
+					break
+				}
+				def.Lines = append(def.Lines, "")
+				def.Pos = append(def.Pos, src.posAt(i+1))
+				i++
+				continue
+			}
+			if !isFootnoteContinuation(next) {
+				break
+			}
+			def.Lines = append(def.Lines, dedentFootnote(next))
+			def.Pos = append(def.Pos, src.posAt(i+1))
+			i++
+		}
+		defs[id] = def
+	}
+
+	// 脚注之间也可以互相引用
+	for _, id := range defOrder {
+		def := defs[id]
+		for i, line := range def.Lines {
+			addRefs(line, def.posAt(i))
+		}
+	}
+
+	for _, id := range refOrder {
+		if _, ok := defs[id]; !ok {
+			fmt.Printf("Warning: %s: 脚注 [^%s] 没有定义\n", refs[id], id)
+		}
+	}
+	for _, id := range defOrder {
+		if _, ok := refs[id]; !ok {
+			fmt.Printf("Warning: %s: 脚注 [^%s] 定义了但没有被引用\n", defs[id].posAt(0), id)
+		}
+	}
+	return body, defs
+}
+
+func isFootnoteContinuation(line string) bool {
+	return strings.HasPrefix(line, "    ") || strings.HasPrefix(line, "\t")
+}
+
+func dedentFootnote(line string) string {
+	if strings.HasPrefix(line, "\t") {
+		return line[1:]
+	}
+	return strings.TrimPrefix(line, "    ")
+}
+
+// resolveFootnotes 按在正文中第一次出现的顺序给脚注编号，替换占位标记，
+// 并在章节末尾追加带回链的脚注列表。没有定义的引用还原为 [^id]。
+func resolveFootnotes(html string, defs map[string]source, chapterNum string, isFront bool) string {
+	var order []string
+	num := make(map[string]int)
+	refCount := make(map[string]int)
+
+	replace := func(s string) string {
+		return footnoteMarkRe.ReplaceAllStringFunc(s, func(mark string) string {
+			id := footnoteMarkRe.FindStringSubmatch(mark)[1]
+			if _, ok := defs[id]; !ok {
+				return "[^" + escapeHTML(id) + "]"
+			}
+			if num[id] == 0 {
+				order = append(order, id)
+				num[id] = len(order)
+			}
+			refCount[id]++
+			refID := fmt.Sprintf("fnref-%d", num[id])
+			if refCount[id] > 1 {
+				refID += fmt.Sprintf("-%d", refCount[id])
+			}
+			return fmt.Sprintf("<sup class=\"footnote-ref\"><a href=\"#fn-%d\" id=\"%s\" epub:type=\"noteref\" role=\"doc-noteref\">%d</a></sup>", num[id], refID, num[id])
+		})
+	}
+
+	html = replace(html)
+	if len(order) == 0 {
+		return html
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("<section class=\"footnotes\" role=\"doc-endnotes\">\n<hr />\n<ol>\n")
+	// 脚注内容里也可能引用其它脚注，order 会在循环中继续增长
+	for k := 0; k < len(order); k++ {
+		id := order[k]
+		n := num[id]
+		body := replace(markdownToBookHTML(defs[id], chapterNum, isFront))
+
+		var backrefs []string
+		for r := 1; r <= refCount[id]; r++ {
+			href := fmt.Sprintf("#fnref-%d", n)
+			label := "&#8617;"
+			if r > 1 {
+				href += fmt.Sprintf("-%d", r)
+				label += fmt.Sprintf("<sup>%d</sup>", r)
+			}
+			backrefs = append(backrefs, fmt.Sprintf("<a href=\"%s\" class=\"footnote-backref\" role=\"doc-backlink\">%s</a>", href, label))
+		}
+		back := strings.Join(backrefs, " ")
+
+		// 回链放在最后一段的末尾
+		body = strings.TrimRight(body, "\n")
+		if strings.HasSuffix(body, "</p>") {
+			body = strings.TrimSuffix(body, "</p>") + " " + back + "</p>"
+		} else {
+			body += "\n<p>" + back + "</p>"
+		}
+		buf.WriteString(fmt.Sprintf("<li id=\"fn-%d\" epub:type=\"footnote\" role=\"doc-footnote\">\n%s\n</li>\n", n, body))
+	}
+	buf.WriteString("</ol>\n</section>\n")
+	return html + buf.String()
+}
@@ -0,0 +1,66 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"mdbook-gen/internal/config"
+)
+
+func TestFootnotes(t *testing.T) {
+	tests := []struct {
+		name, md string
+		want     []string
+	}{
+		{
+			name: "有定义",
+			md:   "正文[^a]。\n\n[^a]: 脚注内容",
+			want: []string{`<a href="#fn-1" id="fnref-1"`, `<li id="fn-1"`, "脚注内容"},
+		},
+		{
+			name: "本章没有任何定义",
+			md:   "正文[^x]。",
+			want: []string{"正文[^x]。"},
+		},
+		{
+			name: "引用了未定义的脚注",
+			md:   "正文[^a][^x]。\n\n[^a]: 脚注内容",
+			want: []string{`id="fnref-1"`, "[^x]。"},
+		},
+		{
+			name: "未定义的脚注中的 &",
+			md:   "正文[^R&D]。\n\n[^a]: 脚注内容",
+			want: []string{"正文[^R&amp;D]。"},
+		},
+		{
+			name: "行内代码",
+			md:   "写成 `[^x]` 的形式",
+			want: []string{"<code>[^x]</code>"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := renderMarkdown(t, config.Config{}, tt.md)
+			for _, w := range tt.want {
+				if !strings.Contains(out, w) {
+					t.Errorf("输出中没有 %s:\n%s", w, out)
+				}
+			}
+		})
+	}
+}
+
+func TestExtractFootnotesWarnings(t *testing.T) {
+	src := source{
+		Lines: []string{"`[^x]` 和[^c][^b][^a]", "", "[^a]: 定义", "[^z]: 没有引用", "[^y]: 没有引用"},
+		Pos:   []srcPos{{"a.md", 1}, {"a.md", 2}, {"a.md", 3}, {"a.md", 4}, {"a.md", 5}},
+	}
+	out := captureOutput(t, func() { extractFootnotes(src) })
+	want := "Warning: a.md:1: 脚注 [^c] 没有定义\n" +
+		"Warning: a.md:1: 脚注 [^b] 没有定义\n" +
+		"Warning: a.md:4: 脚注 [^z] 定义了但没有被引用\n" +
+		"Warning: a.md:5: 脚注 [^y] 定义了但没有被引用\n"
+	if out != want {
+		t.Errorf("警告:\n%s\n应该是:\n%s", out, want)
+	}
+}
@@ -0,0 +1,297 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"html/template"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// glossaryTerm 是 glossary.yaml 中的一个术语
+type glossaryTerm struct {
+	Term       string   `yaml:"term"`
+	Expansion  string   `yaml:"expansion"` // 缩写的全称，存在时用 <abbr> 标记
+	Definition string   `yaml:"definition"`
+	Aliases    []string `yaml:"aliases"` // 其它写法，同样会被识别
+
+	anchor string
+}
+
+// glossaryUse 记录术语在某一章中的第一次出现
+type glossaryUse struct {
+	Page   string
+	Title  string
+	Number string
+	Anchor string
+}
+
+type glossary struct {
+	terms   []*glossaryTerm
+	byName  map[string]*glossaryTerm // 术语名和别名 -> 术语
+	byHTML  map[string]*glossaryTerm // 转义后的术语名和别名 -> 术语，autoRe 在已转义的正文中匹配
+	autoRe  *regexp.Regexp
+	uses    map[*glossaryTerm][]glossaryUse
+	outFile string
+}
+
+const glossaryFile = "glossary.html"
+
+// loadGlossary 读取术语表，文件不存在时返回 nil
+func loadGlossary(rootDir string) (*glossary, error) {
+	name := conf.Glossary.File
+	if name == "" {
+		name = "glossary.yaml"
+	}
+	path := filepath.Join(rootDir, name)
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) && conf.Glossary.File == "" {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("无法读取术语表 %s: %w", name, err)
+	}
+
+	var terms []*glossaryTerm
+	if err := yaml.Unmarshal(data, &terms); err != nil {
+		return nil, fmt.Errorf("解析术语表 %s 失败: %w", name, err)
+	}
+
+	g := &glossary{
+		byName:  make(map[string]*glossaryTerm),
+		byHTML:  make(map[string]*glossaryTerm),
+		uses:    make(map[*glossaryTerm][]glossaryUse),
+		outFile: glossaryFile,
+	}
+	var names []string
+	for i, t := range terms {
+		if t.Term == "" {
+			fmt.Printf("Warning: %s: 第 %d 个术语缺少 term\n", name, i+1)
+			continue
+		}
+		t.anchor = "term-" + slugify(t.Term)
+		if t.anchor == "term-" {
+			t.anchor = fmt.Sprintf("term-%d", i+1)
+		}
+		g.terms = append(g.terms, t)
+		for _, n := range append([]string{t.Term}, t.Aliases...) {
+			if prev, dup := g.byName[n]; dup && prev != t {
+				fmt.Printf("Warning: %s: %q 同时属于术语 %s 和 %s\n", name, n, prev.Term, t.Term)
+			}
+			g.byName[n] = t
+			g.byHTML[escapeHTML(n)] = t
+			names = append(names, escapeHTML(n))
+		}
+	}
+	sort.Slice(g.terms, func(i, j int) bool { return collateLess(g.terms[i].Term, g.terms[j].Term) })
+
+	// 正文已经转义过，名字也按转义后的写法匹配 ("R&D" -> "R&amp;D")。
+	// 长的名字优先匹配，避免 "HTTP" 抢先匹配 "HTTP/2"
+	sort.Slice(names, func(i, j int) bool { return len(names[i]) > len(names[j]) })
+	quoted := make([]string, len(names))
+	for i, n := range names {
+		quoted[i] = regexp.QuoteMeta(n)
+	}
+	if len(quoted) > 0 {
+		g.autoRe = regexp.MustCompile(strings.Join(quoted, "|"))
+	}
+	return g, nil
+}
+
+// collateLess 按不区分大小写的顺序比较
+func collateLess(a, b string) bool {
+	la, lb := strings.ToLower(a), strings.ToLower(b)
+	if la != lb {
+		return la < lb
+	}
+	return a < b
+}
+
+// {术语} 或 {显示文字|术语}
+var glossaryMarkRe = regexp.MustCompile(`\{([^{}|#:\n]+?)(?:\|([^{}|\n]+?))?\}`)
+
+// 这些元素内部的文字不做术语链接
+var glossarySkipTags = map[string]bool{
+	"a": true, "code": true, "pre": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true,
+	"math": true, "script": true, "style": true, "abbr": true, "dfn": true, "sup": true, "kbd": true, "samp": true,
+	"button": true,
+}
+
+// link 给一章中的术语加上链接: {术语} 总是标记，其余术语只标记本章的第一次出现
+func (g *glossary) link(ch *Chapter) {
+	used := make(map[*glossaryTerm]bool)
+	ch.Content = template.HTML(mapHTMLText(string(ch.Content), glossarySkipTags, func(text string) string {
+		// 先处理显式标记
+		text = glossaryMarkRe.ReplaceAllStringFunc(text, func(m string) string {
+			sub := glossaryMarkRe.FindStringSubmatch(m)
+			display, name := sub[1], sub[1]
+			if sub[2] != "" {
+				name = sub[2]
+			}
+			t, ok := g.byName[html.UnescapeString(strings.TrimSpace(name))]
+			if !ok {
+				return m
+			}
+			return "\x00" + g.markup(t, strings.TrimSpace(display), ch, used) + "\x00"
+		})
+		if g.autoRe == nil || conf.Glossary.NoAutoLink {
+			return strings.ReplaceAll(text, "\x00", "")
+		}
+
+		// 自动链接只处理显式标记之外的文字
+		parts := strings.Split(text, "\x00")
+		for i := 0; i < len(parts); i += 2 {
+			parts[i] = g.autoLink(parts[i], ch, used)
+		}
+		return strings.Join(parts, "")
+	}))
+}
+
+// autoLink 标记文本中本章尚未出现过的术语。
+// 英文术语要求前后不是字母或数字，避免 "GC" 匹配到 "GCC" 里面。
+func (g *glossary) autoLink(text string, ch *Chapter, used map[*glossaryTerm]bool) string {
+	var buf bytes.Buffer
+	last := 0
+	for _, loc := range g.autoRe.FindAllStringIndex(text, -1) {
+		m := text[loc[0]:loc[1]]
+		t := g.byHTML[m]
+		if used[t] || isWordByte(text, loc[0]-1) && isWordByte(text, loc[0]) || isWordByte(text, loc[1]) && isWordByte(text, loc[1]-1) {
+			continue
+		}
+		buf.WriteString(text[last:loc[0]])
+		buf.WriteString(g.markup(t, m, ch, used))
+		last = loc[1]
+	}
+	buf.WriteString(text[last:])
+	return buf.String()
+}
+
+func isWordByte(s string, i int) bool {
+	if i < 0 || i >= len(s) {
+		return false
+	}
+	c := s[i]
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_'
+}
+
+// markup 生成术语的 HTML，并记录本章的第一次使用
+func (g *glossary) markup(t *glossaryTerm, display string, ch *Chapter, used map[*glossaryTerm]bool) string {
+	id := ""
+	if !used[t] {
+		used[t] = true
+		anchor := "gl-" + strings.TrimPrefix(t.anchor, "term-")
+		id = fmt.Sprintf(` id="%s"`, anchor)
+		g.uses[t] = append(g.uses[t], glossaryUse{Page: ch.OutputFile, Title: ch.Title, Number: ch.Number, Anchor: anchor})
+	}
+	inner := fmt.Sprintf(`<dfn title="%s">%s</dfn>`, escapeAttr(t.Definition), display)
+	if t.Expansion != "" {
+		inner = fmt.Sprintf(`<abbr title="%s">%s</abbr>`, escapeAttr(t.Expansion), display)
+	}
+	return fmt.Sprintf(`<a class="term"%s href="%s">%s</a>`, id, pageHref(g.outFile+"#"+t.anchor), inner)
+}
+
+// page 生成术语表页面，每个术语附带使用它的章节的回链
+func (g *glossary) page() Chapter {
+	var buf bytes.Buffer
+	buf.WriteString("<h1 id=\"glossary\">术语表</h1>\n\n<dl class=\"glossary\">\n")
+	for _, t := range g.terms {
+		buf.WriteString(fmt.Sprintf("<dt id=\"%s\"><dfn>%s</dfn>", t.anchor, escapeHTML(t.Term)))
+		if t.Expansion != "" {
+			buf.WriteString(fmt.Sprintf(" <span class=\"expansion\">(%s)</span>", escapeHTML(t.Expansion)))
+		}
+		buf.WriteString("</dt>\n<dd>\n")
+		if t.Definition != "" {
+			buf.WriteString(fmt.Sprintf("<p>%s</p>\n", processInline(t.Definition)))
+		}
+		if uses := g.uses[t]; len(uses) > 0 {
+			links := make([]string, len(uses))
+			for i, u := range uses {
+				label := u.Title
+				if u.Number != "" {
+					label = strings.TrimSuffix(u.Number, ".") + " " + u.Title
+				}
+				links[i] = fmt.Sprintf("<a href=\"%s\">%s</a>", pageHref(u.Page+"#"+u.Anchor), escapeHTML(label))
+			}
+			buf.WriteString(fmt.Sprintf("<p class=\"term-refs\">出现于: %s</p>\n", strings.Join(links, "、")))
+		}
+		buf.WriteString("</dd>\n")
+	}
+	buf.WriteString("</dl>\n")
+	return Chapter{
+		ID:         strings.TrimSuffix(g.outFile, ".html"),
+		Title:      "术语表",
+		OutputFile: g.outFile,
+		Content:    template.HTML(buf.String()),
+	}
+}
+
+// mapHTMLText 对 HTML 中的文本节点调用 fn，跳过 skip 中列出的元素内部的文字
+func mapHTMLText(html string, skip map[string]bool, fn func(string) string) string {
+	var buf bytes.Buffer
+	depth := 0
+	for len(html) > 0 {
+		lt := strings.IndexByte(html, '<')
+		if lt < 0 {
+			lt = len(html)
+		}
+		if lt > 0 {
+			if depth == 0 {
+				buf.WriteString(fn(html[:lt]))
+			} else {
+				buf.WriteString(html[:lt])
+			}
+			html = html[lt:]
+			continue
+		}
+
+		// 不是标签的 "<" (例如正文中的 a < b) 按文字处理
+		if len(html) < 2 || !(isASCIILetter(rune(html[1])) || html[1] == '/' || html[1] == '!') {
+			if depth == 0 {
+				buf.WriteString(fn("<"))
+			} else {
+				buf.WriteString("<")
+			}
+			html = html[1:]
+			continue
+		}
+
+		end := strings.IndexByte(html, '>')
+		if strings.HasPrefix(html, "<!--") {
+			end = strings.Index(html, "-->") + 2
+		}
+		if end < 0 {
+			buf.WriteString(html)
+			break
+		}
+		tag := html[:end+1]
+		buf.WriteString(tag)
+		html = html[end+1:]
+
+		name := strings.TrimPrefix(tag[1:], "/")
+		if i := strings.IndexAny(name, " \t\n/>"); i >= 0 {
+			name = name[:i]
+		}
+		if !skip[strings.ToLower(name)] || strings.HasSuffix(tag, "/>") {
+			continue
+		}
+		if strings.HasPrefix(tag, "</") {
+			if depth > 0 {
+				depth--
+			}
+		} else {
+			depth++
+		}
+	}
+	return buf.String()
+}
+
+// escapeAttr 转义属性值
+func escapeAttr(s string) string {
+	return strings.ReplaceAll(escapeHTML(s), `"`, "&quot;")
+}
@@ -0,0 +1,114 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mdbook-gen/internal/config"
+)
+
+const testGlossary = `- term: GC
+  expansion: Garbage Collection
+  definition: 自动回收不再使用的内存
+  aliases: [垃圾回收]
+- term: R&D
+  definition: 研发
+- term: "<T>"
+  definition: 类型参数
+`
+
+// linkTestGlossary 按配置 c 渲染 md，再用 testGlossary 标记术语，返回正文
+func linkTestGlossary(t *testing.T, c config.Config, md string) string {
+	t.Helper()
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, "glossary.yaml"), []byte(testGlossary), 0644); err != nil {
+		t.Fatal(err)
+	}
+	chapters := renderTestChapters(t, c, md)
+	g, err := loadGlossary(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	g.link(&chapters[0])
+	return string(chapters[0].Content)
+}
+
+func TestGlossaryLinks(t *testing.T) {
+	tests := []struct {
+		name, md   string
+		noAutoLink bool
+		want       []string
+		wantNot    []string
+		links      int // class="term" 的个数
+	}{
+		{
+			name:  "只链接第一次出现",
+			md:    "GC 会暂停程序。\n\n再说一次 GC。",
+			want:  []string{`<a class="term" id="gl-gc" href=`, `<abbr title="Garbage Collection">GC</abbr></a> 会暂停程序`, "再说一次 GC。"},
+			links: 1,
+		},
+		{
+			name:  "单词中间不链接",
+			md:    "GCC 不是 GC。",
+			want:  []string{"GCC 不是 <a class=\"term\""},
+			links: 1,
+		},
+		{
+			name:  "别名",
+			md:    "垃圾回收和 GC",
+			want:  []string{`<abbr title="Garbage Collection">垃圾回收</abbr>`},
+			links: 1,
+		},
+		{
+			name:  "需要转义的术语",
+			md:    "R&D 部门的 <T> 参数",
+			want:  []string{`<dfn title="研发">R&amp;D</dfn></a>`, `<dfn title="类型参数">&lt;T&gt;</dfn></a>`},
+			links: 2,
+		},
+		{
+			name:    "代码和标题中不链接",
+			md:      "## GC\n\n`GC` 和 `{GC}`",
+			want:    []string{"<code>GC</code>", "<code>{GC}</code>"},
+			wantNot: []string{"<a class=\"term\""},
+		},
+		{
+			name:  "显式标记",
+			md:    "GC 之后又是 {GC} 和 {回收器|GC} 和 {R&D}",
+			want:  []string{"<p>GC 之后又是 <a class=\"term\" id=\"gl-gc\"", `<abbr title="Garbage Collection">回收器</abbr>`, `<dfn title="研发">R&amp;D</dfn>`},
+			links: 3,
+		},
+		{
+			name:       "no_auto_link",
+			md:         "GC 和 {GC}",
+			noAutoLink: true,
+			want:       []string{"<p>GC 和 <a class=\"term\" id=\"gl-gc\""},
+			links:      1,
+		},
+		{
+			name:    "未定义的显式标记",
+			md:      "{未知}",
+			want:    []string{"{未知}"},
+			wantNot: []string{"<a class=\"term\""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			out := linkTestGlossary(t, config.Config{Glossary: config.GlossaryConfig{NoAutoLink: tt.noAutoLink}}, tt.md)
+			for _, w := range tt.want {
+				if !strings.Contains(out, w) {
+					t.Errorf("输出中没有 %s:\n%s", w, out)
+				}
+			}
+			for _, w := range tt.wantNot {
+				if strings.Contains(out, w) {
+					t.Errorf("输出中有 %s:\n%s", w, out)
+				}
+			}
+			if n := strings.Count(out, `<a class="term"`); n != tt.links {
+				t.Errorf("有 %d 个术语链接，应该是 %d 个:\n%s", n, tt.links, out)
+			}
+		})
+	}
+}
@@ -0,0 +1,155 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/mozillazg/go-pinyin"
+	"golang.org/x/text/unicode/norm"
+)
+
+// heading 是章节中的一个标题
+type heading struct {
+	Level  int
+	Text   string // Markdown 原文，已去掉 {#id}
+	ID     string
+	Number string // headings.numbers 开启时的编号，例如 "3.1.2"
+}
+
+// ## 标题 {#custom-id}
+var headingIDRe = regexp.MustCompile(`\s*\{#([A-Za-z0-9_][\w.:-]*)\}\s*$`)
+
+// splitHeadingID 把 "标题 {#id}" 拆成标题和自定义 ID
+func splitHeadingID(title string) (string, string) {
+	m := headingIDRe.FindStringSubmatchIndex(title)
+	if m == nil {
+		return title, ""
+	}
+	return title[:m[0]], title[m[2]:m[3]]
+}
+
+// headingIDs 给一章中的标题分配不重复的 ID: example、example-1、example-2 ...
+type headingIDs struct {
+	used map[string]bool
+	list []heading
+
+	prefix   string // 章号，例如 "3" 或 "1.2"，没有章号的页面为空，不编号
+	counters [5]int // 各级标题的计数
+}
+
+// 当前章节的标题，由 renderChapter 设置
+var chapterHeadings *headingIDs
+
+func newHeadingIDs() *headingIDs {
+	return &headingIDs{used: make(map[string]bool)}
+}
+
+// add 登记一个标题并返回它的 ID。自定义 ID 重复时给出提示，自动生成的 ID 重复时加上序号。
+func (h *headingIDs) add(level int, title string, pos srcPos) heading {
+	text, id := splitHeadingID(title)
+	if id != "" {
+		if h.used[id] {
+			fmt.Printf("Warning: %s: 标题 ID #%s 重复\n", pos, id)
+		}
+	} else {
+		base := slugify(text)
+		if base == "" {
+			base = "section"
+		}
+		id = base
+		for n := 1; h.used[id]; n++ {
+			id = fmt.Sprintf("%s-%d", base, n)
+		}
+	}
+	h.used[id] = true
+	hd := heading{Level: level, Text: strings.TrimSpace(text), ID: id, Number: h.number(level)}
+	h.list = append(h.list, hd)
+	return hd
+}
+
+// number 返回标题的编号: 章号加上各级计数，例如第 3 章中的 H3 为 "3.1.2"。
+// 不在 headings.numbers 中的级别也计数，只是不显示编号。
+func (h *headingIDs) number(level int) string {
+	if h.prefix == "" || level < 2 {
+		return ""
+	}
+	h.counters[level]++
+	for l := level + 1; l < len(h.counters); l++ {
+		h.counters[l] = 0
+	}
+	numbered := false
+	for _, l := range conf.Headings.Numbers {
+		numbered = numbered || l == level
+	}
+	if !numbered {
+		return ""
+	}
+	parts := []string{h.prefix}
+	for l := 2; l <= level; l++ {
+		parts = append(parts, strconv.Itoa(h.counters[l]))
+	}
+	return strings.Join(parts, ".")
+}
+
+// headingTitleRe 匹配 HTML 标签，headingTitle 用它去掉行内格式
+var headingTitleRe = regexp.MustCompile(`<[^>]*>`)
+
+// headingTitle 返回标题在目录、侧边栏和本页大纲中显示的 HTML。
+// 标题先和正文一样渲染行内格式 (代码、强调、转义字符等)，再去掉标签只留文字，因为这些地方的标题本身就是链接。
+func headingTitle(text string) string {
+	return strings.TrimSpace(headingTitleRe.ReplaceAllString(processInline(text), ""))
+}
+
+// renderHeading 输出 h1–h4，H2–H4 后面带一个鼠标悬停时显示的 # 链接
+func renderHeading(level int, title string, pos srcPos) string {
+	if chapterHeadings == nil {
+		chapterHeadings = newHeadingIDs()
+	}
+	hd := chapterHeadings.add(level, title, pos)
+	permalink := ""
+	if level > 1 && !conf.Headings.NoPermalinks {
+		permalink = fmt.Sprintf(` <a class="permalink" href="#%s" aria-label="链接到本节">#</a>`, hd.ID)
+	}
+	// 编号本身也是一个锚点 (#sec-3-1-2)，和图表的 #fig-3-2 一样
+	number := ""
+	if hd.Number != "" {
+		number = fmt.Sprintf(`<span class="heading-number" id="sec-%s">%s</span> `, strings.ReplaceAll(hd.Number, ".", "-"), hd.Number)
+	}
+	return fmt.Sprintf("<h%d id=\"%s\">%s%s%s</h%d>\n\n", level, hd.ID, number, processInline(hd.Text), permalink, level)
+}
+
+// transliterate 把文字转换为 ASCII: 去掉重音符号 (é -> e)，汉字在 withPinyin 时转为拼音，其余非 ASCII 字符去掉
+func transliterate(s string, withPinyin bool) string {
+	var b strings.Builder
+	args := pinyin.NewArgs()
+	for _, r := range norm.NFD.String(s) {
+		switch {
+		case r < unicode.MaxASCII:
+			b.WriteRune(r)
+		case unicode.Is(unicode.Mn, r):
+			// 组合用的重音符号
+		case unicode.Is(unicode.Han, r):
+			if withPinyin {
+				if p := pinyin.LazyPinyin(string(r), args); len(p) > 0 {
+					b.WriteString(" " + p[0] + " ")
+				}
+			}
+		default:
+			if t, ok := latinLigatures[r]; ok {
+				b.WriteString(t)
+			} else if unicode.IsSpace(r) || unicode.IsPunct(r) {
+				b.WriteRune(' ')
+			}
+		}
+	}
+	return b.String()
+}
+
+// NFD 分解不了的拉丁字母
+var latinLigatures = map[rune]string{
+	'ß': "ss", 'æ': "ae", 'Æ': "AE", 'œ': "oe", 'Œ': "OE", 'ø': "o", 'Ø': "O",
+	'đ': "d", 'Đ': "D", 'ł': "l", 'Ł': "L", 'þ': "th", 'Þ': "TH", 'ð': "d",
+}
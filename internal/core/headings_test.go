@@ -0,0 +1,85 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"mdbook-gen/internal/config"
+)
+
+func TestSlugify(t *testing.T) {
+	tests := []struct {
+		slug, title, want string
+	}{
+		{"", "Hello World", "hello-world"},
+		{"", "第 3 章：并发编程", "并发编程"},
+		{"", "3.2 Goroutine 调度", "goroutine-调度"},
+		{"", "第一章", "第一章"},
+		{"", "Café 和 かな", "caf-和"},
+		{"", "C++ / Go", "c-go"},
+		{"keep-unicode", "Café", "café"},
+		{"unicode", "Café", "café"},
+		{"keep-unicode", "かな 和 Привет", "かな-和-привет"},
+		{"keep-unicode", "第 3 章：并发编程", "并发编程"},
+		{"keep-unicode", "C++ / Go", "c-go"},
+		{"ascii-transliteration", "Café 中文 Straße", "cafe-strasse"},
+		{"ascii", "Œuvre", "oeuvre"},
+		{"pinyin", "中文标题", "zhong-wen-biao-ti"},
+		{"pinyin", "Go 语言", "go-yu-yan"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.slug+"/"+tt.title, func(t *testing.T) {
+			setConfig(t, config.Config{Headings: config.HeadingsConfig{Slug: tt.slug}})
+			if got := slugify(tt.title); got != tt.want {
+				t.Errorf("slugify(%q) = %q，应该是 %q", tt.title, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSlugUnknownStrategy(t *testing.T) {
+	setConfig(t, config.Config{Headings: config.HeadingsConfig{Slug: "latin"}})
+	var got string
+	out := captureOutput(t, func() { got = slugify("Café 中文") })
+	if got != "café-中文" {
+		t.Errorf("slugify = %q，应该按 keep-unicode 处理", got)
+	}
+	if !strings.Contains(out, `未知的 headings.slug 设置 "latin"`) {
+		t.Errorf("没有警告: %q", out)
+	}
+}
+
+func TestHeadingIDs(t *testing.T) {
+	setConfig(t, config.Config{})
+	tests := []struct {
+		titles []string
+		want   []string
+	}{
+		{[]string{"Example", "Example", "Example"}, []string{"example", "example-1", "example-2"}},
+		{[]string{"Example", "Example {#example-1}", "Example"}, []string{"example", "example-1", "example-2"}},
+		{[]string{"安装 Go {#install}", "安装 Go"}, []string{"install", "安装-go"}},
+		{[]string{"!!!", "???"}, []string{"section", "section-1"}},
+	}
+	for _, tt := range tests {
+		ids := newHeadingIDs()
+		var got []string
+		for _, title := range tt.titles {
+			got = append(got, ids.add(2, title, srcPos{}).ID)
+		}
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("%q 的 ID 为 %q，应该是 %q", tt.titles, got, tt.want)
+		}
+	}
+}
+
+func TestHeadingIDDuplicateCustom(t *testing.T) {
+	setConfig(t, config.Config{})
+	ids := newHeadingIDs()
+	out := captureOutput(t, func() {
+		ids.add(2, "A {#same}", srcPos{"a.md", 1})
+		ids.add(2, "B {#same}", srcPos{"a.md", 2})
+	})
+	if !strings.Contains(out, "a.md:2: 标题 ID #same 重复") {
+		t.Errorf("没有重复 ID 的警告: %q", out)
+	}
+}
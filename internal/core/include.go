@@ -0,0 +1,148 @@
+package core
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// srcPos 记录展开后的一行来自哪个文件的第几行，用于诊断信息
+type srcPos struct {
+	File string
+	Line int
+}
+
+func (p srcPos) String() string {
+	return fmt.Sprintf("%s:%d", p.File, p.Line)
+}
+
+// source 是展开 include 之后的章节内容，Lines 与 Pos 一一对应
+type source struct {
+	Lines []string
+	Pos   []srcPos
+}
+
+func (s source) String() string {
+	return strings.Join(s.Lines, "\n")
+}
+
+// posAt 返回第 i 行的原始位置，越界时返回空位置
+func (s source) posAt(i int) srcPos {
+	if i >= 0 && i < len(s.Pos) {
+		return s.Pos[i]
+	}
+	return srcPos{}
+}
+
+// {{#include path}} 或 {{#include path shift=1}}，必须单独占一行
+var includeRe = regexp.MustCompile(`^\s*\{\{#include\s+(\S+?)(?:\s+shift=([+-]?\d+))?\s*\}\}\s*$`)
+
+// loadSource 读取章节文件并递归展开其中的 include 指令
+func loadSource(rootDir, file string) (source, error) {
+	var src source
+	err := expandIncludes(rootDir, file, 0, nil, srcPos{}, &src)
+	return src, err
+}
+
+// expandIncludes 把 file 的内容追加到 src 中。
+// shift 为标题层级偏移量，stack 为当前的 include 链，用于检测循环引用，
+// from 是触发本次 include 的位置 (顶层文件为空)。
+func expandIncludes(rootDir, file string, shift int, stack []string, from srcPos, src *source) error {
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		abs = file
+	}
+	display := file
+	if rel, err := filepath.Rel(rootDir, file); err == nil && !strings.HasPrefix(rel, "..") {
+		display = rel
+	}
+
+	for i, seen := range stack {
+		if seen == abs {
+			chain := make([]string, 0, len(stack)-i+1)
+			for _, s := range stack[i:] {
+				chain = append(chain, filepath.Base(s))
+			}
+			chain = append(chain, filepath.Base(abs))
+			return fmt.Errorf("%s: 循环 include: %s", from, strings.Join(chain, " -> "))
+		}
+	}
+
+	content, err := os.ReadFile(file)
+	if err != nil {
+		if from.File == "" {
+			return fmt.Errorf("无法读取 %s: %w", display, err)
+		}
+		return fmt.Errorf("%s: 无法 include %s: %w", from, display, err)
+	}
+	stack = append(stack, abs)
+
+	inFence := false
+	for n, line := range strings.Split(strings.TrimSuffix(string(content), "\n"), "\n") {
+		line = strings.TrimSuffix(line, "\r")
+		pos := srcPos{File: display, Line: n + 1}
+
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+		}
+
+		// \{{#include ...}} 用于原样输出指令本身
+		if strings.HasPrefix(strings.TrimSpace(line), `\{{#include`) {
+			line = strings.Replace(line, `\{{#include`, `{{#include`, 1)
+		} else if m := includeRe.FindStringSubmatch(line); m != nil {
+			target := m[1]
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(filepath.Dir(file), target)
+			}
+			if inFence {
+				// 代码块内的 include 原样插入文件内容，不再展开也不调整标题
+				data, err := os.ReadFile(target)
+				if err != nil {
+					return fmt.Errorf("%s: 无法 include %s: %w", pos, m[1], err)
+				}
+				for _, l := range strings.Split(strings.TrimSuffix(string(data), "\n"), "\n") {
+					src.Lines = append(src.Lines, strings.TrimSuffix(l, "\r"))
+					src.Pos = append(src.Pos, pos)
+				}
+				continue
+			}
+			childShift := shift
+			if m[2] != "" {
+				delta, _ := strconv.Atoi(m[2])
+				childShift += delta
+			}
+			if err := expandIncludes(rootDir, target, childShift, stack, pos, src); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if !inFence && shift != 0 {
+			line = shiftHeading(line, shift)
+		}
+		src.Lines = append(src.Lines, line)
+		src.Pos = append(src.Pos, pos)
+	}
+	return nil
+}
+
+var atxHeadingRe = regexp.MustCompile(`^(#{1,6}) `)
+
+// shiftHeading 调整 ATX 标题的层级，结果限制在 1~4 级之间 (正文只渲染 h1–h4)
+func shiftHeading(line string, shift int) string {
+	m := atxHeadingRe.FindStringSubmatch(line)
+	if m == nil {
+		return line
+	}
+	level := len(m[1]) + shift
+	if level < 1 {
+		level = 1
+	}
+	if level > 4 {
+		level = 4
+	}
+	return strings.Repeat("#", level) + line[len(m[1]):]
+}
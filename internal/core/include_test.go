@@ -0,0 +1,70 @@
+package core
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestShiftHeading(t *testing.T) {
+	tests := []struct {
+		line  string
+		shift int
+		want  string
+	}{
+		{"# 标题", 1, "## 标题"},
+		{"## 标题", -1, "# 标题"},
+		{"# 标题", -3, "# 标题"},
+		{"### 标题", 1, "#### 标题"},
+		{"### 标题", 3, "#### 标题"},
+		{"#### 标题", 2, "#### 标题"},
+		{"#标题", 1, "#标题"},
+		{"正文", 1, "正文"},
+	}
+	for _, tt := range tests {
+		if got := shiftHeading(tt.line, tt.shift); got != tt.want {
+			t.Errorf("shiftHeading(%q, %d) = %q，应该是 %q", tt.line, tt.shift, got, tt.want)
+		}
+	}
+}
+
+func TestIncludePaths(t *testing.T) {
+	dir := t.TempDir()
+	shared := filepath.Join(dir, "shared")
+	book := filepath.Join(dir, "book")
+	for _, d := range []string{shared, book} {
+		if err := os.MkdirAll(d, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write := func(path, content string) {
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write(filepath.Join(shared, "a.md"), "## 片段 A\n")
+	write(filepath.Join(shared, "b.md"), "### 片段 B\n")
+	chapter := filepath.Join(book, "01-x.md")
+	write(chapter, "# 章\n{{#include ../shared/a.md shift=1}}\n{{#include "+filepath.Join(shared, "b.md")+" shift=3}}\n")
+
+	src, err := loadSource(dir, chapter)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := "# 章\n### 片段 A\n#### 片段 B"
+	if got := src.String(); got != want {
+		t.Errorf("展开结果:\n%s\n应该是:\n%s", got, want)
+	}
+}
+
+func TestIncludeCycle(t *testing.T) {
+	dir := t.TempDir()
+	a, b := filepath.Join(dir, "a.md"), filepath.Join(dir, "b.md")
+	os.WriteFile(a, []byte("{{#include b.md}}\n"), 0644)
+	os.WriteFile(b, []byte("{{#include a.md}}\n"), 0644)
+	_, err := loadSource(dir, a)
+	if err == nil || !strings.Contains(err.Error(), "循环 include: a.md -> b.md -> a.md") {
+		t.Errorf("err = %v，应该报告循环 include", err)
+	}
+}
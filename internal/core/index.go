@@ -0,0 +1,254 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"html/template"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/collate"
+	"golang.org/x/text/language"
+)
+
+var (
+	// {index: 词条} 或 {index: 主词条!子词条}
+	indexRe = regexp.MustCompile(`\{index:\s*([^{}\n]*?)\s*\}`)
+	// processInline 输出的占位标记，由 buildIndex 替换成锚点
+	indexMarkRe = regexp.MustCompile(`<a class="index-mark" data-index="([^"]*)"></a>`)
+)
+
+const indexFile = "book-index.html"
+
+// indexLocation 是词条在某一章中的第一次出现
+type indexLocation struct {
+	Page   string
+	Anchor string
+	Label  string // 章号，没有章号的页面用标题
+}
+
+type indexEntry struct {
+	Term string // 原始写法 (可含 `代码` 等行内标记)
+	Locs []indexLocation
+	Subs map[string]*indexEntry
+}
+
+func (e *indexEntry) addLoc(loc indexLocation) {
+	for _, l := range e.Locs {
+		if l.Page == loc.Page {
+			return
+		}
+	}
+	e.Locs = append(e.Locs, loc)
+}
+
+// indexMark 是 processInline 为 {index: ...} 生成的占位标记
+func indexMark(term string) string {
+	return fmt.Sprintf(`<a class="index-mark" data-index="%s"></a>`, escapeAttr(term))
+}
+
+// buildIndex 把各章中的索引标记替换成锚点，并生成索引页面。没有任何索引标记时返回 nil。
+func buildIndex(chapters []Chapter) *Chapter {
+	entries := make(map[string]*indexEntry)
+	for i := range chapters {
+		ch := &chapters[i]
+		label := strings.TrimSuffix(ch.Number, ".")
+		if label == "" {
+			label = ch.Title
+		}
+		n := 0
+		ch.Content = template.HTML(indexMarkRe.ReplaceAllStringFunc(string(ch.Content), func(mark string) string {
+			term := html.UnescapeString(indexMarkRe.FindStringSubmatch(mark)[1])
+			path := strings.Split(term, "!")
+			for k := range path {
+				path[k] = strings.TrimSpace(path[k])
+			}
+			if term == "" || path[0] == "" {
+				fmt.Printf("Warning: %s: 空的索引标记 {index: %s}\n", chapterDisplayPath(*ch), term)
+				return ""
+			}
+			if len(path) > 2 {
+				fmt.Printf("Warning: %s: 索引词条 %q 最多支持两级，多余的部分被合并到子词条\n", chapterDisplayPath(*ch), term)
+				path = []string{path[0], strings.Join(path[1:], "!")}
+			}
+
+			n++
+			loc := indexLocation{Page: ch.OutputFile, Anchor: fmt.Sprintf("idx-%d", n), Label: label}
+			e := entries[path[0]]
+			if e == nil {
+				e = &indexEntry{Term: path[0], Subs: make(map[string]*indexEntry)}
+				entries[path[0]] = e
+			}
+			if len(path) == 1 || path[1] == "" {
+				e.addLoc(loc)
+			} else {
+				sub := e.Subs[path[1]]
+				if sub == nil {
+					sub = &indexEntry{Term: path[1]}
+					e.Subs[path[1]] = sub
+				}
+				sub.addLoc(loc)
+			}
+			return fmt.Sprintf(`<span class="index-target" id="%s"></span>`, loc.Anchor)
+		}))
+	}
+	if len(entries) == 0 {
+		return nil
+	}
+
+	c := newIndexCollator()
+	groups := make(map[string][]*indexEntry)
+	for _, e := range entries {
+		g := c.group(e.Term)
+		groups[g] = append(groups[g], e)
+	}
+	var letters []string
+	for g := range groups {
+		letters = append(letters, g)
+	}
+	// 符号和数字开头的词条排在最前面
+	sort.Slice(letters, func(i, j int) bool {
+		if letters[i] == "#" || letters[j] == "#" {
+			return letters[i] == "#" && letters[j] != "#"
+		}
+		return c.less(letters[i], letters[j])
+	})
+
+	title := conf.Index.Title
+	if title == "" {
+		title = "索引"
+	}
+	var buf bytes.Buffer
+	buf.WriteString(fmt.Sprintf("<h1 id=\"index\">%s</h1>\n\n", escapeHTML(title)))
+	buf.WriteString("<nav class=\"index-letters\">")
+	for i, g := range letters {
+		if i > 0 {
+			buf.WriteString(" ")
+		}
+		buf.WriteString(fmt.Sprintf("<a href=\"#index-%d\">%s</a>", i+1, escapeHTML(g)))
+	}
+	buf.WriteString("</nav>\n\n")
+
+	for i, g := range letters {
+		list := groups[g]
+		c.sort(list)
+		buf.WriteString(fmt.Sprintf("<section class=\"index-group\">\n<h2 id=\"index-%d\">%s</h2>\n<ul class=\"index\">\n", i+1, escapeHTML(g)))
+		for _, e := range list {
+			buf.WriteString("<li>" + renderIndexEntry(e))
+			if len(e.Subs) > 0 {
+				subs := make([]*indexEntry, 0, len(e.Subs))
+				for _, s := range e.Subs {
+					subs = append(subs, s)
+				}
+				c.sort(subs)
+				buf.WriteString("\n<ul>\n")
+				for _, s := range subs {
+					buf.WriteString("<li>" + renderIndexEntry(s) + "</li>\n")
+				}
+				buf.WriteString("</ul>\n")
+			}
+			buf.WriteString("</li>\n")
+		}
+		buf.WriteString("</ul>\n</section>\n")
+	}
+
+	return &Chapter{
+		ID:         strings.TrimSuffix(indexFile, ".html"),
+		Title:      title,
+		OutputFile: indexFile,
+		Content:    template.HTML(buf.String()),
+	}
+}
+
+// renderIndexEntry 输出 "词条, 3.1, 5" 形式的一行，页码链接到标记所在的位置
+func renderIndexEntry(e *indexEntry) string {
+	s := "<span class=\"index-term\">" + processInline(e.Term) + "</span>"
+	for _, l := range e.Locs {
+		s += fmt.Sprintf(", <a href=\"%s\">%s</a>", pageHref(l.Page+"#"+l.Anchor), escapeHTML(l.Label))
+	}
+	return s
+}
+
+// 汉字按拼音分组时使用的边界字: 拼音首字母为该字母的汉字在排序上不早于对应的边界字
+var pinyinBoundaries = []struct {
+	Letter string
+	Char   string
+}{
+	{"A", "阿"}, {"B", "八"}, {"C", "嚓"}, {"D", "哒"}, {"E", "妸"}, {"F", "发"}, {"G", "旮"},
+	{"H", "哈"}, {"J", "讥"}, {"K", "咔"}, {"L", "垃"}, {"M", "痳"}, {"N", "拏"}, {"O", "噢"},
+	{"P", "妑"}, {"Q", "七"}, {"R", "呥"}, {"S", "仨"}, {"T", "他"}, {"W", "穵"}, {"X", "夕"},
+	{"Y", "丫"}, {"Z", "帀"},
+}
+
+// indexCollator 按 index.locale 排序词条，中文按拼音
+type indexCollator struct {
+	col    *collate.Collator
+	pinyin bool
+}
+
+func newIndexCollator() *indexCollator {
+	locale := conf.Index.Locale
+	if locale == "" {
+		locale = "zh"
+	}
+	tag, err := language.Parse(locale)
+	if err != nil {
+		fmt.Printf("Warning: 无法识别 index.locale %q，使用 zh\n", locale)
+		tag = language.Chinese
+	}
+	base, _ := tag.Base()
+	zh, _ := language.Chinese.Base()
+	return &indexCollator{
+		col:    collate.New(tag, collate.IgnoreCase, collate.Loose),
+		pinyin: base == zh,
+	}
+}
+
+// sortKey 去掉词条中的行内标记，只按文字排序
+func sortKey(term string) string {
+	return strings.TrimSpace(strings.NewReplacer("`", "", "*", "").Replace(term))
+}
+
+func (c *indexCollator) less(a, b string) bool {
+	if r := c.col.CompareString(sortKey(a), sortKey(b)); r != 0 {
+		return r < 0
+	}
+	return a < b
+}
+
+func (c *indexCollator) sort(list []*indexEntry) {
+	sort.Slice(list, func(i, j int) bool { return c.less(list[i].Term, list[j].Term) })
+}
+
+// group 返回词条所属的首字母分组: 拉丁字母取首字母 (忽略重音)，汉字取拼音首字母，其余归入 "#"
+func (c *indexCollator) group(term string) string {
+	key := sortKey(term)
+	if key == "" {
+		return "#"
+	}
+	r := []rune(key)[0]
+	if unicode.Is(unicode.Han, r) && c.pinyin {
+		letter := "#"
+		for _, b := range pinyinBoundaries {
+			if c.col.CompareString(string(r), b.Char) < 0 {
+				break
+			}
+			letter = b.Letter
+		}
+		return letter
+	}
+	if !unicode.IsLetter(r) {
+		return "#"
+	}
+	// 带重音的字母和基本字母归为一组 (É -> E)
+	up := strings.ToUpper(string(r))
+	for l := 'A'; l <= 'Z'; l++ {
+		if c.col.CompareString(up, string(l)) == 0 {
+			return string(l)
+		}
+	}
+	return up
+}
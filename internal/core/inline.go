@@ -0,0 +1,382 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// inlineStash 暂存已经生成好的 HTML 片段，正文中用占位符代替，避免被后续的行内规则再次处理
+type inlineStash []string
+
+func (s *inlineStash) put(html string) string {
+	*s = append(*s, html)
+	return fmt.Sprintf("\x00%d\x00", len(*s)-1)
+}
+
+var stashRe = regexp.MustCompile("\x00(\\d+)\x00")
+
+// restore 还原占位符。链接文字等片段本身也可能包含占位符，因此递归还原。
+func (s inlineStash) restore(text string) string {
+	if len(s) == 0 {
+		return text
+	}
+	return stashRe.ReplaceAllStringFunc(text, func(m string) string {
+		n, _ := strconv.Atoi(strings.Trim(m, "\x00"))
+		return s.restore(s[n])
+	})
+}
+
+// linkRef 是 [ref]: url "title" 形式的链接定义
+type linkRef struct {
+	URL   string
+	Title string
+}
+
+// 当前章节的链接定义，由 renderChapter 设置
+var chapterLinkRefs map[string]linkRef
+
+var (
+	// [ref]: url "title"，必须独占一行，最多缩进 3 个空格
+	linkRefDefRe = regexp.MustCompile(`^ {0,3}\[([^\]^][^\]]*)\]:\s*<?([^\s>]+)>?(?:\s+(?:"([^"]*)"|'([^']*)'|\(([^)]*)\)))?\s*$`)
+
+	autolinkRe = regexp.MustCompile(`<((?:https?|ftp|mailto):[^\s<>]+|[\w.+-]+@[\w-]+(?:\.[\w-]+)+)>`)
+	rawHTMLRe  = regexp.MustCompile(`<!--.*?-->|</?[A-Za-z][A-Za-z0-9-]*(?:\s+[^<>]*)?/?>`)
+	escapeRe   = regexp.MustCompile("\\\\([!\"#$%&'()*+,\\-./:;<=>?@\\[\\\\\\]^_`{|}~])")
+
+	linkRe        = regexp.MustCompile(`\[((?:[^\[\]]|\[[^\[\]]*\])*)\]\(\s*([^\s()]*(?:\([^\s()]*\)[^\s()]*)*)(?:\s+"([^"]*)")?\s*\)`)
+	refLinkRe     = regexp.MustCompile(`\[((?:[^\[\]]|\[[^\[\]]*\])+)\](?:\[([^\[\]]*)\])?`)
+	refImageRe    = regexp.MustCompile(`!\[([^\[\]]*)\]\[([^\[\]]*)\]`)
+	bareURLRe     = regexp.MustCompile(`(?:https?://|www\.)[^\s<>"'，。；：！？、（）【】《》“”]+`)
+	strongEmRe    = regexp.MustCompile(`\*\*\*(\S(?:.*?\S)?)\*\*\*`)
+	strongRe      = regexp.MustCompile(`\*\*(\S(?:.*?\S)?)\*\*`)
+	emRe          = regexp.MustCompile(`\*(\S(?:[^*]*?\S)?)\*`)
+	strongUnderRe = regexp.MustCompile(`__(\S(?:.*?\S)?)__`)
+	emUnderRe     = regexp.MustCompile(`_(\S(?:[^_]*?\S)?)_`)
+	strikeRe      = regexp.MustCompile(`~~(\S(?:.*?\S)?)~~`)
+	emojiRe       = regexp.MustCompile(`:([a-z0-9_+-]+):`)
+	entityRe      = regexp.MustCompile(`&(?:#[0-9]{1,7};|#[xX][0-9a-fA-F]{1,6};|[A-Za-z][A-Za-z0-9]{1,31};)?`)
+)
+
+// extractLinkRefs 取出章节中的链接定义，返回去掉定义后的正文
+func extractLinkRefs(src source) (source, map[string]linkRef) {
+	var body source
+	refs := make(map[string]linkRef)
+	inFence := false
+	for i, line := range src.Lines {
+		if strings.HasPrefix(strings.TrimSpace(line), "```") {
+			inFence = !inFence
+		}
+		m := linkRefDefRe.FindStringSubmatch(line)
+		if inFence || m == nil {
+			body.Lines = append(body.Lines, line)
+			body.Pos = append(body.Pos, src.posAt(i))
+			continue
+		}
+		label := normalizeLinkLabel(m[1])
+		if _, dup := refs[label]; dup {
+			fmt.Printf("Warning: %s: 链接定义 [%s] 重复，使用第一个\n", src.posAt(i), m[1])
+			continue
+		}
+		refs[label] = linkRef{URL: m[2], Title: m[3] + m[4] + m[5]}
+	}
+	return body, refs
+}
+
+// normalizeLinkLabel 链接标签不区分大小写，连续空白视为一个空格
+func normalizeLinkLabel(s string) string {
+	return strings.ToLower(strings.Join(strings.Fields(s), " "))
+}
+
+func processInline(text string) string {
+	var stash inlineStash
+	return stash.restore(inlineSpans(text, &stash))
+}
+
+// inlineSpans 依次处理行内元素，生成的 HTML 放入 stash。
+// 优先级从高到低: 代码、自动链接、HTML 标签、公式、反斜杠转义、各种标记、图片、链接、强调。
+// 先处理的内容不会再被后面的规则改写，例如代码中的 ** 和 _ 保持原样。
+func inlineSpans(text string, stash *inlineStash) string {
+	// 行内代码
+	text = replaceCodeSpans(text, func(code string) string {
+		return stash.put("<code>" + escapeHTML(code) + "</code>")
+	})
+	// <https://...> 和 <user@example.com>
+	text = autolinkRe.ReplaceAllStringFunc(text, func(m string) string {
+		target := m[1 : len(m)-1]
+		href := target
+		if !strings.Contains(target, ":") {
+			href = "mailto:" + target
+		}
+		return stash.put(fmt.Sprintf(`<a href="%s">%s</a>`, escapeAttr(safeURL(href, false)), escapeHTML(target)))
+	})
+	// 内嵌的 HTML 标签按 html.raw 的设置输出，属性中的 * _ 等字符不做处理
+	text = rawHTMLRe.ReplaceAllStringFunc(text, func(tag string) string {
+		return stash.put(filterRawHTML(tag))
+	})
+	// 公式 (MathML 中的 * _ 等字符不能再被当作强调处理)
+	if !conf.Math.Disabled {
+		text = replaceInlineMath(text, func(tex string, display bool) string {
+			return stash.put(renderMath(tex, display))
+		})
+	}
+	// \* \_ \[ 等转义字符
+	text = escapeRe.ReplaceAllStringFunc(text, func(m string) string {
+		return stash.put(escapeHTML(m[1:]))
+	})
+
+	// 索引标记 {index: 词条}，锚点由 buildIndex 统一生成
+	text = indexRe.ReplaceAllStringFunc(text, func(m string) string {
+		return stash.put(indexMark(indexRe.FindStringSubmatch(m)[1]))
+	})
+	// 文献引用 [@key]，引用文字由 resolveCitations 统一生成
+	if conf.Bibliography.File != "" {
+		text = citationRe.ReplaceAllStringFunc(text, func(m string) string {
+			if mark := citationMark(citationRe.FindStringSubmatch(m)); mark != "" {
+				return stash.put(mark)
+			}
+			return m
+		})
+	}
+	// 图表交叉引用 @fig:标签 / @tbl:标签
+	text = xrefRe.ReplaceAllStringFunc(text, func(m string) string {
+		sub := xrefRe.FindStringSubmatch(m)
+		return sub[1] + stash.put(fmt.Sprintf(`<a class="xref" data-ref="%s"></a>`, sub[2]))
+	})
+	// 脚注引用 (编号由 resolveFootnotes 统一分配)
+	text = footnoteRefRe.ReplaceAllStringFunc(text, func(m string) string {
+		return stash.put(fmt.Sprintf(`<sup class="footnote-ref" data-fn="%s"></sup>`, footnoteRefRe.FindStringSubmatch(m)[1]))
+	})
+
+	// 图片 (带标题或 {#fig:标签} 的图片会被编号)，包括 ![alt][ref]
+	text = imageRe.ReplaceAllStringFunc(text, func(m string) string {
+		return stash.put(renderImage(imageRe.FindStringSubmatch(m)))
+	})
+	text = refImageRe.ReplaceAllStringFunc(text, func(m string) string {
+		sub := refImageRe.FindStringSubmatch(m)
+		label := sub[2]
+		if label == "" {
+			label = sub[1]
+		}
+		ref, ok := chapterLinkRefs[normalizeLinkLabel(label)]
+		if !ok {
+			return m
+		}
+		return stash.put(renderImage([]string{m, sub[1], ref.URL, ref.Title, ""}))
+	})
+
+	// 链接: [文字](url "标题")、[文字][ref]、[文字][]、[ref]
+	text = linkRe.ReplaceAllStringFunc(text, func(m string) string {
+		sub := linkRe.FindStringSubmatch(m)
+		return stash.put(renderLink(sub[1], sub[2], sub[3]))
+	})
+	text = refLinkRe.ReplaceAllStringFunc(text, func(m string) string {
+		sub := refLinkRe.FindStringSubmatch(m)
+		label := sub[2]
+		if label == "" {
+			label = sub[1]
+		}
+		ref, ok := chapterLinkRefs[normalizeLinkLabel(label)]
+		if !ok {
+			return m
+		}
+		return stash.put(renderLink(sub[1], ref.URL, ref.Title))
+	})
+	// 正文中的网址
+	text = replaceBareURLs(text, func(m string) string {
+		url, rest := trimURLPunct(m)
+		href := url
+		if strings.HasPrefix(url, "www.") {
+			href = "http://" + url
+		}
+		return stash.put(fmt.Sprintf(`<a href="%s">%s</a>`, escapeAttr(href), escapeHTML(url))) + rest
+	})
+
+	// 剩下的都是普通文字
+	text = emphasis(escapeText(text))
+	text = replaceEmoji(text)
+	return escapeAmpersands(text)
+}
+
+// renderLink 输出链接，链接文字中可以有强调、代码等行内元素 (但不能再嵌套链接)
+func renderLink(label, url, title string) string {
+	titleAttr := ""
+	if title != "" {
+		titleAttr = fmt.Sprintf(` title="%s"`, escapeAttr(title))
+	}
+	url = pageHref(strings.ReplaceAll(escapeAmpersands(safeURL(url, false)), `"`, "%22"))
+	return fmt.Sprintf(`<a href="%s"%s>%s</a>`, url, titleAttr, escapeAmpersands(replaceEmoji(emphasis(escapeText(label)))))
+}
+
+// emphasis 处理 ***粗斜体***、**粗体**、*斜体*、__粗体__、_斜体_ 和 ~~删除线~~。
+// 下划线只在单词边界生效，snake_case_name 中的 _ 保持原样。
+func emphasis(text string) string {
+	text = strongEmRe.ReplaceAllString(text, "<em><strong>$1</strong></em>")
+	text = strongRe.ReplaceAllString(text, "<strong>$1</strong>")
+	text = emRe.ReplaceAllString(text, "<em>$1</em>")
+	text = replaceFlanked(text, strongUnderRe, "<strong>", "</strong>")
+	text = replaceFlanked(text, emUnderRe, "<em>", "</em>")
+	return strikeRe.ReplaceAllString(text, "<del>$1</del>")
+}
+
+// replaceFlanked 只替换前后都不是字母或数字的匹配
+func replaceFlanked(text string, re *regexp.Regexp, open, close string) string {
+	var buf bytes.Buffer
+	last := 0
+	for _, loc := range re.FindAllStringSubmatchIndex(text, -1) {
+		if loc[0] < last {
+			continue
+		}
+		before, _ := utf8.DecodeLastRuneInString(text[:loc[0]])
+		after, _ := utf8.DecodeRuneInString(text[loc[1]:])
+		if isWordRune(before) || isWordRune(after) {
+			continue
+		}
+		buf.WriteString(text[last:loc[0]])
+		buf.WriteString(open + text[loc[2]:loc[3]] + close)
+		last = loc[1]
+	}
+	buf.WriteString(text[last:])
+	return buf.String()
+}
+
+func isWordRune(r rune) bool {
+	return r != utf8.RuneError && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_')
+}
+
+// replaceCodeSpans 找出 `代码` 和 “含有 ` 的代码“，按 CommonMark 的规则去掉两端各一个空格
+func replaceCodeSpans(text string, fn func(code string) string) string {
+	if !strings.Contains(text, "`") {
+		return text
+	}
+	var buf bytes.Buffer
+	for i := 0; i < len(text); {
+		if text[i] == '\\' && i+1 < len(text) && text[i+1] == '`' {
+			buf.WriteString(text[i : i+2])
+			i += 2
+			continue
+		}
+		if text[i] != '`' {
+			buf.WriteByte(text[i])
+			i++
+			continue
+		}
+		n := 1
+		for i+n < len(text) && text[i+n] == '`' {
+			n++
+		}
+		end := closingBackticks(text, i+n, n)
+		if end < 0 {
+			buf.WriteString(text[i : i+n])
+			i += n
+			continue
+		}
+		code := text[i+n : end]
+		if len(code) > 1 && code[0] == ' ' && code[len(code)-1] == ' ' && strings.Trim(code, " ") != "" {
+			code = code[1 : len(code)-1]
+		}
+		buf.WriteString(fn(code))
+		i = end + n
+	}
+	return buf.String()
+}
+
+// closingBackticks 从 from 开始查找恰好 n 个反引号组成的结束标记
+func closingBackticks(text string, from, n int) int {
+	for j := from; j < len(text); {
+		if text[j] != '`' {
+			j++
+			continue
+		}
+		k := j
+		for k < len(text) && text[k] == '`' {
+			k++
+		}
+		if k-j == n {
+			return j
+		}
+		j = k
+	}
+	return -1
+}
+
+// replaceBareURLs 替换正文中的网址，网址前面紧挨着字母或数字时不算 (例如 awww.)
+func replaceBareURLs(text string, fn func(string) string) string {
+	var buf bytes.Buffer
+	last := 0
+	for _, loc := range bareURLRe.FindAllStringIndex(text, -1) {
+		if before, _ := utf8.DecodeLastRuneInString(text[:loc[0]]); isWordRune(before) || before == '/' || before == '@' {
+			continue
+		}
+		buf.WriteString(text[last:loc[0]])
+		buf.WriteString(fn(text[loc[0]:loc[1]]))
+		last = loc[1]
+	}
+	buf.WriteString(text[last:])
+	return buf.String()
+}
+
+// trimURLPunct 去掉网址末尾的标点，括号只在不配对时去掉
+func trimURLPunct(url string) (string, string) {
+	end := len(url)
+	for end > 0 {
+		c := url[end-1]
+		if strings.IndexByte(".,:;!?*_~'\"", c) >= 0 {
+			end--
+			continue
+		}
+		if c == ')' && strings.Count(url[:end], "(") < strings.Count(url[:end], ")") {
+			end--
+			continue
+		}
+		break
+	}
+	return url[:end], url[end:]
+}
+
+// escapeAmpersands 转义不属于 HTML 实体的 &，合法的实体 (&copy; &#169;) 保持不变
+func escapeAmpersands(text string) string {
+	return entityRe.ReplaceAllStringFunc(text, func(m string) string {
+		if m == "&" || html.UnescapeString(m) == m {
+			return "&amp;" + m[1:]
+		}
+		return m
+	})
+}
+
+// replaceEmoji 替换 :smile: 形式的表情代码，不认识的代码保持原样
+func replaceEmoji(text string) string {
+	if !strings.Contains(text, ":") {
+		return text
+	}
+	return emojiRe.ReplaceAllStringFunc(text, func(m string) string {
+		if e, ok := emojiShortcodes[m[1:len(m)-1]]; ok {
+			return e
+		}
+		return m
+	})
+}
+
+// 常用的 GitHub 表情代码
+var emojiShortcodes = map[string]string{
+	"smile": "😄", "smiley": "😃", "grinning": "😀", "laughing": "😆", "joy": "😂", "wink": "😉",
+	"blush": "😊", "heart_eyes": "😍", "thinking": "🤔", "sweat_smile": "😅", "sob": "😭", "cry": "😢",
+	"confused": "😕", "scream": "😱", "sunglasses": "😎", "neutral_face": "😐", "disappointed": "😞",
+	"+1": "👍", "thumbsup": "👍", "-1": "👎", "thumbsdown": "👎", "clap": "👏", "pray": "🙏",
+	"wave": "👋", "point_right": "👉", "point_left": "👈", "ok_hand": "👌", "muscle": "💪", "eyes": "👀",
+	"heart": "❤️", "broken_heart": "💔", "star": "⭐", "sparkles": "✨", "fire": "🔥", "boom": "💥",
+	"zap": "⚡", "tada": "🎉", "rocket": "🚀", "bulb": "💡", "warning": "⚠️", "no_entry": "⛔",
+	"x": "❌", "heavy_check_mark": "✔️", "white_check_mark": "✅", "ballot_box_with_check": "☑️",
+	"question": "❓", "exclamation": "❗", "memo": "📝", "pencil": "📝", "book": "📖", "books": "📚",
+	"bookmark": "🔖", "link": "🔗", "lock": "🔒", "unlock": "🔓", "key": "🔑", "bell": "🔔",
+	"mag": "🔍", "wrench": "🔧", "hammer": "🔨", "gear": "⚙️", "package": "📦", "bug": "🐛",
+	"computer": "💻", "keyboard": "⌨️", "floppy_disk": "💾", "chart_with_upwards_trend": "📈",
+	"hourglass": "⌛", "alarm_clock": "⏰", "calendar": "📅", "pushpin": "📌", "paperclip": "📎",
+	"construction": "🚧", "recycle": "♻️", "arrow_right": "➡️", "arrow_left": "⬅️", "arrow_up": "⬆️",
+	"arrow_down": "⬇️", "100": "💯", "gopher": "🐹", "coffee": "☕", "beer": "🍺", "trophy": "🏆",
+}
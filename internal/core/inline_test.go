@@ -0,0 +1,63 @@
+package core
+
+import (
+	"testing"
+
+	"mdbook-gen/internal/config"
+)
+
+func TestInlinePrecedence(t *testing.T) {
+	tests := []struct {
+		name, text, want string
+	}{
+		{"代码中的强调", "`**x** _y_`", "<code>**x** _y_</code>"},
+		{"代码优先于强调", "*a `b*` c*", "<em>a <code>b*</code> c</em>"},
+		{"代码中的链接", "`[a](b)`", "<code>[a](b)</code>"},
+		{"代码中的表情", "`:smile:`", "<code>:smile:</code>"},
+		{"代码中的 HTML", "`<b>`", "<code>&lt;b&gt;</code>"},
+		{"双反引号", "``a ` b``", "<code>a ` b</code>"},
+		{"自动链接中的下划线", "<https://example.com/a_b_c>", `<a href="https://example.com/a_b_c">https://example.com/a_b_c</a>`},
+		{"网址中的下划线", "见 https://example.com/a_b_c。", `见 <a href="https://example.com/a_b_c">https://example.com/a_b_c</a>。`},
+		{"邮件地址", "<a_b@example.com>", `<a href="mailto:a_b@example.com">a_b@example.com</a>`},
+		{"snake_case", "snake_case_name 和 a__b__c", "snake_case_name 和 a__b__c"},
+		{"单词边界的下划线", "_斜体_ 和 __粗体__", "<em>斜体</em> 和 <strong>粗体</strong>"},
+		{"粗斜体", "***x***", "<em><strong>x</strong></em>"},
+		{"删除线", "~~旧~~ 新", "<del>旧</del> 新"},
+		{"强调中的删除线", "**~~x~~**", "<strong><del>x</del></strong>"},
+		{"表情", "完成 :tada:", "完成 🎉"},
+		{"未知的表情代码", "时间 10:30:00 和 :nosuch:", "时间 10:30:00 和 :nosuch:"},
+		{"转义字符", `\*不是强调\* \_ \~~`, "*不是强调* _ ~~"},
+		{"链接文字中的强调", "[**粗体**](https://example.com)", `<a href="https://example.com"><strong>粗体</strong></a>`},
+		{"链接文字中的代码", "[`a_b`](https://example.com)", `<a href="https://example.com"><code>a_b</code></a>`},
+		{"& 和实体", "A & B &amp; &copy;", "A &amp; B &amp; &copy;"},
+		{"尖括号", "a < b > c", "a &lt; b &gt; c"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setConfig(t, config.Config{})
+			if got := processInline(tt.text); got != tt.want {
+				t.Errorf("processInline(%q) = %q，应该是 %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestReplaceCodeSpans(t *testing.T) {
+	tests := []struct {
+		text, want string
+	}{
+		{"`a`", "[a]"},
+		{"`` `a` ``", "[`a`]"},
+		{"` a `", "[a]"},
+		{"`  `", "[  ]"},
+		{"\\`a`", "\\`a`"},
+		{"`a", "`a"},
+		{"``a`", "``a`"},
+	}
+	for _, tt := range tests {
+		got := replaceCodeSpans(tt.text, func(code string) string { return "[" + code + "]" })
+		if got != tt.want {
+			t.Errorf("replaceCodeSpans(%q) = %q，应该是 %q", tt.text, got, tt.want)
+		}
+	}
+}
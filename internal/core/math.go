@@ -0,0 +1,811 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// 构建时把 LaTeX 公式转换为 MathML，输出的页面不依赖任何 CDN，离线和 EPUB 阅读器里也能显示。
+// 这里只实现了书中常见的子集，遇到不支持的命令时返回错误，由调用方给出诊断或交给客户端兜底渲染。
+
+// texToMathML 把一个公式转换为 <math> 元素
+func texToMathML(tex string, display bool) (string, error) {
+	p := &mathParser{toks: tokenizeTeX(tex), display: display}
+	body := p.parseExpr()
+	if p.pos < len(p.toks) {
+		p.fail("多余的 %q", p.toks[p.pos].text)
+	}
+
+	mode := "inline"
+	if display {
+		mode = "block"
+	}
+	out := fmt.Sprintf(`<math xmlns="http://www.w3.org/1998/Math/MathML" display="%s"><semantics><mrow>%s</mrow><annotation encoding="application/x-tex">%s</annotation></semantics></math>`,
+		mode, body, escapeHTML(tex))
+	if len(p.errs) > 0 {
+		return out, fmt.Errorf("%s", strings.Join(p.errs, "; "))
+	}
+	return out, nil
+}
+
+type mathToken struct {
+	kind byte // 'c' 命令, 'n' 数字, 'l' 字母, 'o' 其它字符, 以及 '{' '}' '^' '_' '&' '\''
+	text string
+}
+
+func tokenizeTeX(tex string) []mathToken {
+	var toks []mathToken
+	rs := []rune(tex)
+	for i := 0; i < len(rs); i++ {
+		r := rs[i]
+		switch {
+		case unicode.IsSpace(r) || r == '~':
+			// 数学模式下空白没有意义，~ 作为不换行空格也忽略
+		case r == '\\':
+			j := i + 1
+			for j < len(rs) && isASCIILetter(rs[j]) {
+				j++
+			}
+			if j == i+1 && j < len(rs) {
+				j++ // \, \{ \\ 之类的单字符命令
+			}
+			toks = append(toks, mathToken{'c', string(rs[i:j])})
+			i = j - 1
+		case r >= '0' && r <= '9':
+			j := i
+			for j < len(rs) && (rs[j] >= '0' && rs[j] <= '9' || rs[j] == '.' && j+1 < len(rs) && rs[j+1] >= '0' && rs[j+1] <= '9') {
+				j++
+			}
+			toks = append(toks, mathToken{'n', string(rs[i:j])})
+			i = j - 1
+		case unicode.IsLetter(r):
+			toks = append(toks, mathToken{'l', string(r)})
+		case r == '{' || r == '}' || r == '^' || r == '_' || r == '&' || r == '\'':
+			toks = append(toks, mathToken{byte(r), string(r)})
+		default:
+			toks = append(toks, mathToken{'o', string(r)})
+		}
+	}
+	return toks
+}
+
+func isASCIILetter(r rune) bool {
+	return r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z'
+}
+
+type mathParser struct {
+	toks    []mathToken
+	pos     int
+	display bool
+	font    string // 当前 \mathbf 等字体命令的作用范围
+	errs    []string
+}
+
+func (p *mathParser) fail(format string, args ...any) {
+	p.errs = append(p.errs, fmt.Sprintf(format, args...))
+}
+
+func (p *mathParser) peek() (mathToken, bool) {
+	if p.pos < len(p.toks) {
+		return p.toks[p.pos], true
+	}
+	return mathToken{}, false
+}
+
+// atEnd 判断当前表达式是否结束: 右花括号、矩阵的分隔符、\right 和 \end
+func (p *mathParser) atEnd() bool {
+	t, ok := p.peek()
+	if !ok {
+		return true
+	}
+	switch t.kind {
+	case '}', '&':
+		return true
+	case 'c':
+		return t.text == `\\` || t.text == `\right` || t.text == `\end` || t.text == `\middle`
+	}
+	return false
+}
+
+func (p *mathParser) parseExpr() string {
+	var buf bytes.Buffer
+	for !p.atEnd() {
+		buf.WriteString(p.parseTerm())
+	}
+	return buf.String()
+}
+
+// parseTerm 解析一个原子及其上下标
+func (p *mathParser) parseTerm() string {
+	start := p.pos
+	base, limits := p.parseAtom()
+	if p.pos == start {
+		// 防御: 没有消耗任何 token 时跳过一个，避免死循环
+		p.pos++
+	}
+
+	var sub, sup string
+	primes := 0
+	for {
+		t, ok := p.peek()
+		if !ok {
+			break
+		}
+		if t.kind == '\'' {
+			primes++
+			p.pos++
+			continue
+		}
+		if t.kind != '^' && t.kind != '_' {
+			break
+		}
+		p.pos++
+		arg := p.parseArg()
+		if t.kind == '^' {
+			sup = arg
+		} else {
+			sub = arg
+		}
+	}
+	if primes > 0 {
+		prime := "<mo>" + strings.Repeat("′", primes) + "</mo>"
+		if sup == "" {
+			sup = prime
+		} else {
+			sup = "<mrow>" + prime + sup + "</mrow>"
+		}
+	}
+	if sub == "" && sup == "" {
+		return base
+	}
+	if base == "" {
+		base = "<mrow></mrow>"
+	}
+
+	under, over := "msub", "msup"
+	both := "msubsup"
+	if limits && p.display {
+		under, over, both = "munder", "mover", "munderover"
+	}
+	switch {
+	case sup == "":
+		return fmt.Sprintf("<%s>%s%s</%s>", under, base, sub, under)
+	case sub == "":
+		return fmt.Sprintf("<%s>%s%s</%s>", over, base, sup, over)
+	default:
+		return fmt.Sprintf("<%s>%s%s%s</%s>", both, base, sub, sup, both)
+	}
+}
+
+// parseArg 解析命令或上下标的参数: 一个 {...} 组或单个原子
+func (p *mathParser) parseArg() string {
+	t, ok := p.peek()
+	if !ok {
+		p.fail("缺少参数")
+		return "<mrow></mrow>"
+	}
+	if t.kind == '{' {
+		return p.parseGroup()
+	}
+	atom, _ := p.parseAtom()
+	return atom
+}
+
+func (p *mathParser) parseGroup() string {
+	p.pos++ // {
+	inner := p.parseExpr()
+	if t, ok := p.peek(); ok && t.kind == '}' {
+		p.pos++
+	} else {
+		p.fail("花括号没有闭合")
+	}
+	return "<mrow>" + inner + "</mrow>"
+}
+
+// rawArg 读取 {...} 中的原始文本，用于 \text 和环境名
+func (p *mathParser) rawArg() string {
+	t, ok := p.peek()
+	if !ok || t.kind != '{' {
+		p.fail("缺少 {...} 参数")
+		return ""
+	}
+	p.pos++
+	depth := 0
+	var sb strings.Builder
+	for ; p.pos < len(p.toks); p.pos++ {
+		t := p.toks[p.pos]
+		if t.kind == '{' {
+			depth++
+		} else if t.kind == '}' {
+			if depth == 0 {
+				p.pos++
+				return sb.String()
+			}
+			depth--
+		}
+		sb.WriteString(t.text)
+	}
+	p.fail("花括号没有闭合")
+	return sb.String()
+}
+
+// parseAtom 返回原子的 MathML，以及它在行间公式中是否把上下标放在正上/正下方 (\sum、\lim 等)
+func (p *mathParser) parseAtom() (string, bool) {
+	t, ok := p.peek()
+	if !ok {
+		return "", false
+	}
+	switch t.kind {
+	case '{':
+		return p.parseGroup(), false
+	case 'n':
+		p.pos++
+		return "<mn>" + mapFont(t.text, p.font) + "</mn>", false
+	case 'l':
+		p.pos++
+		if p.font == "normal" {
+			// \mathrm{max} 之类: 连续字母合并成一个 <mi>
+			word := t.text
+			for q, ok := p.peek(); ok && q.kind == 'l'; q, ok = p.peek() {
+				word += q.text
+				p.pos++
+			}
+			if len([]rune(word)) == 1 {
+				return `<mi mathvariant="normal">` + escapeHTML(word) + "</mi>", false
+			}
+			return "<mi>" + escapeHTML(word) + "</mi>", false
+		}
+		return "<mi>" + mapFont(t.text, p.font) + "</mi>", false
+	case 'o':
+		p.pos++
+		text := t.text
+		if text == "-" {
+			text = "−"
+		}
+		return "<mo>" + escapeHTML(text) + "</mo>", false
+	case '^', '_', '\'':
+		// 没有底数的上下标，例如 {}^{14}C 或公式开头的 ^2
+		return "", false
+	case 'c':
+		p.pos++
+		return p.parseCommand(t.text)
+	}
+	p.pos++
+	p.fail("无法解析 %q", t.text)
+	return "", false
+}
+
+func (p *mathParser) parseCommand(cmd string) (string, bool) {
+	name := strings.TrimPrefix(cmd, `\`)
+
+	if s, ok := texIdentifiers[name]; ok {
+		if unicode.IsUpper([]rune(s)[0]) {
+			return `<mi mathvariant="normal">` + s + "</mi>", false
+		}
+		return "<mi>" + s + "</mi>", false
+	}
+	if s, ok := texOperators[name]; ok {
+		return "<mo>" + escapeHTML(s) + "</mo>", false
+	}
+	if s, ok := texLargeOperators[name]; ok {
+		return "<mo largeop=\"true\">" + s + "</mo>", !strings.Contains(name, "int")
+	}
+	if texFunctions[name] {
+		return "<mi>" + name + "</mi>", texLimitFunctions[name]
+	}
+	if texIgnored[name] {
+		return "", false
+	}
+	if w, ok := texSpaces[name]; ok {
+		return fmt.Sprintf(`<mspace width="%s"/>`, w), false
+	}
+	if accent, ok := texAccents[name]; ok {
+		arg := p.parseArg()
+		if name == "underline" {
+			return fmt.Sprintf(`<munder accentunder="true">%s<mo stretchy="true">%s</mo></munder>`, arg, accent), false
+		}
+		return fmt.Sprintf(`<mover accent="true">%s<mo stretchy="%t">%s</mo></mover>`, arg, strings.HasPrefix(name, "over") || strings.HasPrefix(name, "wide"), accent), false
+	}
+	if font, ok := texFonts[name]; ok {
+		saved := p.font
+		p.font = font
+		arg := p.parseArg()
+		p.font = saved
+		return arg, false
+	}
+	if size, ok := texBigDelims[strings.TrimRight(name, "lrm")]; ok {
+		delim := p.parseDelimiter()
+		return fmt.Sprintf(`<mo minsize="%s" maxsize="%s">%s</mo>`, size, size, delim), false
+	}
+
+	switch name {
+	case "frac", "dfrac", "tfrac", "cfrac":
+		num := p.parseArg()
+		den := p.parseArg()
+		return fmt.Sprintf("<mfrac>%s%s</mfrac>", num, den), false
+	case "binom":
+		top := p.parseArg()
+		bottom := p.parseArg()
+		return fmt.Sprintf(`<mrow><mo>(</mo><mfrac linethickness="0">%s%s</mfrac><mo>)</mo></mrow>`, top, bottom), false
+	case "sqrt":
+		if t, ok := p.peek(); ok && t.kind == 'o' && t.text == "[" {
+			p.pos++
+			var index bytes.Buffer
+			for t, ok := p.peek(); ok && !(t.kind == 'o' && t.text == "]"); t, ok = p.peek() {
+				index.WriteString(p.parseTerm())
+			}
+			p.pos++ // ]
+			arg := p.parseArg()
+			return fmt.Sprintf("<mroot>%s<mrow>%s</mrow></mroot>", arg, index.String()), false
+		}
+		return fmt.Sprintf("<msqrt>%s</msqrt>", p.parseArg()), false
+	case "text", "textrm", "mbox", "textnormal":
+		return "<mtext>" + escapeHTML(p.rawArg()) + "</mtext>", false
+	case "operatorname":
+		return "<mi>" + escapeHTML(p.rawArg()) + "</mi>", false
+	case "bmod":
+		return `<mo lspace="0.2222em" rspace="0.2222em">mod</mo>`, false
+	case "pmod":
+		return fmt.Sprintf(`<mspace width="0.4444em"/><mo>(</mo><mi>mod</mi><mspace width="0.3333em"/>%s<mo>)</mo>`, p.parseArg()), false
+	case "left":
+		open := p.parseDelimiter()
+		inner := p.parseExpr()
+		for {
+			t, ok := p.peek()
+			if !ok || t.text != `\middle` {
+				break
+			}
+			p.pos++
+			inner += `<mo stretchy="true">` + p.parseDelimiter() + "</mo>" + p.parseExpr()
+		}
+		close := ""
+		if t, ok := p.peek(); ok && t.text == `\right` {
+			p.pos++
+			close = p.parseDelimiter()
+		} else {
+			p.fail(`\left 缺少对应的 \right`)
+		}
+		return fmt.Sprintf(`<mrow><mo fence="true" stretchy="true">%s</mo>%s<mo fence="true" stretchy="true">%s</mo></mrow>`, open, inner, close), false
+	case "begin":
+		return p.parseEnvironment(p.rawArg()), false
+	case "{", "}", "|", "#", "%", "&", "_", "$":
+		if name == "|" {
+			name = "‖"
+		}
+		return "<mo>" + escapeHTML(name) + "</mo>", false
+	}
+
+	p.fail(`不支持的 LaTeX 命令 \%s`, name)
+	return "<merror><mtext>" + escapeHTML(cmd) + "</mtext></merror>", false
+}
+
+// parseDelimiter 解析 \left、\right、\big 之后的定界符，"." 表示空
+func (p *mathParser) parseDelimiter() string {
+	t, ok := p.peek()
+	if !ok {
+		p.fail("缺少定界符")
+		return ""
+	}
+	p.pos++
+	switch {
+	case t.kind == 'o' && t.text == ".":
+		return ""
+	case t.kind == 'o':
+		return escapeHTML(t.text)
+	case t.kind == 'c':
+		name := strings.TrimPrefix(t.text, `\`)
+		if s, ok := texOperators[name]; ok {
+			return escapeHTML(s)
+		}
+		switch name {
+		case "{", "}":
+			return name
+		case "|":
+			return "‖"
+		}
+	}
+	p.fail("无效的定界符 %q", t.text)
+	return ""
+}
+
+// parseEnvironment 解析 matrix、pmatrix、cases、aligned 等环境，输出 <mtable>
+func (p *mathParser) parseEnvironment(env string) string {
+	open, close, align := "", "", ""
+	switch strings.TrimSuffix(env, "*") {
+	case "matrix", "smallmatrix":
+	case "pmatrix":
+		open, close = "(", ")"
+	case "bmatrix":
+		open, close = "[", "]"
+	case "Bmatrix":
+		open, close = "{", "}"
+	case "vmatrix":
+		open, close = "|", "|"
+	case "Vmatrix":
+		open, close = "‖", "‖"
+	case "cases":
+		open, align = "{", "left"
+	case "aligned", "align", "alignedat", "split", "eqnarray":
+		align = "right left"
+	case "gathered", "gather":
+	case "array":
+		p.rawArg() // 列格式，例如 {cc}
+	default:
+		p.fail("不支持的环境 %s", env)
+	}
+
+	var rows []string
+	var cells []string
+	for {
+		cells = append(cells, "<mtd>"+p.parseExpr()+"</mtd>")
+		t, ok := p.peek()
+		if !ok {
+			p.fail("环境 %s 没有 \\end", env)
+			break
+		}
+		p.pos++
+		if t.kind == '&' {
+			continue
+		}
+		if t.text == `\\` {
+			rows = append(rows, "<mtr>"+strings.Join(cells, "")+"</mtr>")
+			cells = nil
+			continue
+		}
+		if t.text == `\end` {
+			if end := p.rawArg(); end != env {
+				p.fail("\\begin{%s} 与 \\end{%s} 不匹配", env, end)
+			}
+			break
+		}
+		p.fail("环境 %s 中出现了意外的 %q", env, t.text)
+		break
+	}
+	// 最后一行以 \\ 结尾时会多出一个空行
+	if len(cells) > 1 || len(cells) == 1 && cells[0] != "<mtd></mtd>" {
+		rows = append(rows, "<mtr>"+strings.Join(cells, "")+"</mtr>")
+	}
+
+	attrs := ""
+	if align != "" {
+		attrs = fmt.Sprintf(` columnalign="%s"`, align)
+	}
+	table := fmt.Sprintf("<mtable%s>%s</mtable>", attrs, strings.Join(rows, ""))
+	if open == "" && close == "" {
+		return table
+	}
+	if close == "" {
+		return fmt.Sprintf(`<mrow><mo fence="true" stretchy="true">%s</mo>%s</mrow>`, open, table)
+	}
+	return fmt.Sprintf(`<mrow><mo fence="true" stretchy="true">%s</mo>%s<mo fence="true" stretchy="true">%s</mo></mrow>`, open, table, close)
+}
+
+// mapFont 把 ASCII 字母和数字映射到 Unicode 数学字母区，
+// 用于 \mathbf、\mathbb 等 (MathML Core 只支持 mathvariant="normal")
+func mapFont(s, font string) string {
+	if font == "" || font == "normal" {
+		return escapeHTML(s)
+	}
+	var sb strings.Builder
+	for _, r := range s {
+		sb.WriteRune(mathAlphanumeric(r, font))
+	}
+	return sb.String()
+}
+
+// 数学字母区中每种字体大写 A、小写 a 和数字 0 的起始码位 (0 表示该字体没有数字)
+var mathFontBase = map[string][3]rune{
+	"bold":          {0x1D400, 0x1D41A, 0x1D7CE},
+	"italic":        {0x1D434, 0x1D44E, 0},
+	"bold-italic":   {0x1D468, 0x1D482, 0x1D7CE},
+	"script":        {0x1D49C, 0x1D4B6, 0},
+	"fraktur":       {0x1D504, 0x1D51E, 0},
+	"double-struck": {0x1D538, 0x1D552, 0x1D7D8},
+	"sans-serif":    {0x1D5A0, 0x1D5BA, 0x1D7E2},
+	"monospace":     {0x1D670, 0x1D68A, 0x1D7F6},
+}
+
+// 数学字母区中空缺的码位，这些字母早已在 Letterlike Symbols 区中存在
+var mathFontHoles = map[string]map[rune]rune{
+	"italic":        {'h': 'ℎ'},
+	"script":        {'B': 'ℬ', 'E': 'ℰ', 'F': 'ℱ', 'H': 'ℋ', 'I': 'ℐ', 'L': 'ℒ', 'M': 'ℳ', 'R': 'ℛ', 'e': 'ℯ', 'g': 'ℊ', 'o': 'ℴ'},
+	"fraktur":       {'C': 'ℭ', 'H': 'ℌ', 'I': 'ℑ', 'R': 'ℜ', 'Z': 'ℨ'},
+	"double-struck": {'C': 'ℂ', 'H': 'ℍ', 'N': 'ℕ', 'P': 'ℙ', 'Q': 'ℚ', 'R': 'ℝ', 'Z': 'ℤ'},
+}
+
+func mathAlphanumeric(r rune, font string) rune {
+	if hole, ok := mathFontHoles[font][r]; ok {
+		return hole
+	}
+	base, ok := mathFontBase[font]
+	if !ok {
+		return r
+	}
+	switch {
+	case r >= 'A' && r <= 'Z':
+		return base[0] + r - 'A'
+	case r >= 'a' && r <= 'z':
+		return base[1] + r - 'a'
+	case r >= '0' && r <= '9' && base[2] != 0:
+		return base[2] + r - '0'
+	}
+	return r
+}
+
+var texFonts = map[string]string{
+	"mathbf":     "bold",
+	"bf":         "bold",
+	"mathit":     "italic",
+	"boldsymbol": "bold-italic",
+	"mathcal":    "script",
+	"mathscr":    "script",
+	"mathfrak":   "fraktur",
+	"mathbb":     "double-struck",
+	"mathsf":     "sans-serif",
+	"mathtt":     "monospace",
+	"mathrm":     "normal",
+	"rm":         "normal",
+	"mathnormal": "",
+}
+
+// 只影响排版尺寸的命令，MathML 中直接忽略
+var texIgnored = map[string]bool{
+	"displaystyle": true, "textstyle": true, "scriptstyle": true, "limits": true, "nolimits": true,
+}
+
+var texIdentifiers = map[string]string{
+	"alpha": "α", "beta": "β", "gamma": "γ", "delta": "δ", "epsilon": "ϵ", "varepsilon": "ε",
+	"zeta": "ζ", "eta": "η", "theta": "θ", "vartheta": "ϑ", "iota": "ι", "kappa": "κ",
+	"lambda": "λ", "mu": "μ", "nu": "ν", "xi": "ξ", "pi": "π", "varpi": "ϖ", "rho": "ρ",
+	"varrho": "ϱ", "sigma": "σ", "varsigma": "ς", "tau": "τ", "upsilon": "υ", "phi": "ϕ",
+	"varphi": "φ", "chi": "χ", "psi": "ψ", "omega": "ω",
+	"Gamma": "Γ", "Delta": "Δ", "Theta": "Θ", "Lambda": "Λ", "Xi": "Ξ", "Pi": "Π",
+	"Sigma": "Σ", "Upsilon": "Υ", "Phi": "Φ", "Psi": "Ψ", "Omega": "Ω",
+	"infty": "∞", "partial": "∂", "nabla": "∇", "emptyset": "∅", "varnothing": "∅",
+	"hbar": "ℏ", "ell": "ℓ", "aleph": "ℵ", "Re": "ℜ", "Im": "ℑ", "angle": "∠",
+	"triangle": "△", "prime": "′", "top": "⊤", "bot": "⊥", "imath": "ı", "jmath": "ȷ",
+}
+
+var texOperators = map[string]string{
+	"pm": "±", "mp": "∓", "times": "×", "div": "÷", "cdot": "⋅", "ast": "∗", "star": "⋆",
+	"circ": "∘", "bullet": "∙", "le": "≤", "leq": "≤", "ge": "≥", "geq": "≥", "ne": "≠",
+	"neq": "≠", "approx": "≈", "equiv": "≡", "sim": "∼", "simeq": "≃", "cong": "≅",
+	"propto": "∝", "ll": "≪", "gg": "≫", "in": "∈", "notin": "∉", "ni": "∋",
+	"subset": "⊂", "subseteq": "⊆", "supset": "⊃", "supseteq": "⊇", "cup": "∪", "cap": "∩",
+	"setminus": "∖", "land": "∧", "wedge": "∧", "lor": "∨", "vee": "∨", "neg": "¬",
+	"lnot": "¬", "to": "→", "rightarrow": "→", "leftarrow": "←", "gets": "←",
+	"Rightarrow": "⇒", "Leftarrow": "⇐", "Leftrightarrow": "⇔", "leftrightarrow": "↔",
+	"iff": "⟺", "implies": "⟹", "mapsto": "↦", "longrightarrow": "⟶", "longleftarrow": "⟵",
+	"uparrow": "↑", "downarrow": "↓", "forall": "∀", "exists": "∃", "nexists": "∄",
+	"mid": "∣", "parallel": "∥", "perp": "⊥", "langle": "⟨", "rangle": "⟩",
+	"lfloor": "⌊", "rfloor": "⌋", "lceil": "⌈", "rceil": "⌉", "ldots": "…", "cdots": "⋯",
+	"vdots": "⋮", "ddots": "⋱", "dots": "…", "colon": ":", "vert": "|", "Vert": "‖",
+	"oplus": "⊕", "otimes": "⊗", "odot": "⊙", "lbrace": "{", "rbrace": "}",
+	"therefore": "∴", "because": "∵", "models": "⊨", "vdash": "⊢", "prec": "≺", "succ": "≻",
+	"preceq": "⪯", "succeq": "⪰", "lt": "<", "gt": ">", "backslash": "∖",
+}
+
+var texLargeOperators = map[string]string{
+	"sum": "∑", "prod": "∏", "coprod": "∐", "bigcup": "⋃", "bigcap": "⋂",
+	"bigoplus": "⨁", "bigotimes": "⨂", "bigvee": "⋁", "bigwedge": "⋀",
+	"int": "∫", "iint": "∬", "iiint": "∭", "oint": "∮",
+}
+
+var texFunctions = map[string]bool{
+	"sin": true, "cos": true, "tan": true, "cot": true, "sec": true, "csc": true,
+	"arcsin": true, "arccos": true, "arctan": true, "sinh": true, "cosh": true, "tanh": true,
+	"log": true, "ln": true, "lg": true, "exp": true, "lim": true, "max": true, "min": true,
+	"sup": true, "inf": true, "det": true, "gcd": true, "deg": true, "dim": true,
+	"ker": true, "arg": true, "Pr": true, "liminf": true, "limsup": true,
+}
+
+// 行间公式中上下标放在正下/正上方的函数
+var texLimitFunctions = map[string]bool{
+	"lim": true, "max": true, "min": true, "sup": true, "inf": true, "det": true,
+	"gcd": true, "Pr": true, "liminf": true, "limsup": true,
+}
+
+var texSpaces = map[string]string{
+	",": "0.1667em", ":": "0.2222em", ">": "0.2222em", ";": "0.2778em", " ": "0.3333em",
+	"quad": "1em", "qquad": "2em", "!": "-0.1667em", "thinspace": "0.1667em",
+}
+
+var texAccents = map[string]string{
+	"hat": "^", "widehat": "^", "bar": "¯", "overline": "‾", "vec": "→",
+	"overrightarrow": "→", "tilde": "˜", "widetilde": "˜", "dot": "˙", "ddot": "¨",
+	"underline": "_",
+}
+
+var texBigDelims = map[string]string{
+	"big": "1.2em", "Big": "1.623em", "bigg": "2.047em", "Bigg": "2.470em",
+}
+
+// findInlineMath 在一行文本中查找行内公式，返回每个公式 (含定界符) 的起止位置。
+// 规则与 Pandoc 一致: $ 之后不能是空白，结束的 $ 之前不能是空白、之后不能紧跟数字，
+// 因此 "$5 和 $10" 这类金额不会被误认为公式；$$...$$ 写在行内时作为行间公式；
+// \$ 表示字面的美元符号；反引号中的代码不会被处理。
+func findInlineMath(text string) [][2]int {
+	var spans [][2]int
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++ // 跳过被转义的字符
+		case '`':
+			n := 1
+			for i+n < len(text) && text[i+n] == '`' {
+				n++
+			}
+			fence := text[i : i+n]
+			if end := strings.Index(text[i+n:], fence); end >= 0 {
+				i += n + end + n - 1
+			} else {
+				i += n - 1
+			}
+		case '$':
+			if strings.HasPrefix(text[i:], "$$") {
+				if end := strings.Index(text[i+2:], "$$"); end > 0 {
+					spans = append(spans, [2]int{i, i + 2 + end + 2})
+					i += 2 + end + 1
+				} else {
+					i++
+				}
+				continue
+			}
+			if i+1 >= len(text) || text[i+1] == ' ' || text[i+1] == '\t' {
+				continue
+			}
+			for j := i + 1; j < len(text); j++ {
+				if text[j] == '\\' {
+					j++
+					continue
+				}
+				if text[j] == '`' {
+					break // 公式不能跨进行内代码
+				}
+				if text[j] != '$' {
+					continue
+				}
+				if text[j-1] == ' ' || text[j-1] == '\t' || j+1 < len(text) && text[j+1] >= '0' && text[j+1] <= '9' {
+					continue
+				}
+				spans = append(spans, [2]int{i, j + 1})
+				i = j
+				break
+			}
+		}
+	}
+	return spans
+}
+
+// renderMath 输出一个公式。转换失败时，如果配置了客户端兜底，输出原始 TeX 交给 MathJax，
+// 否则把 TeX 源码原样显示在 code.math-error 中。
+func renderMath(tex string, display bool) string {
+	mathml, err := texToMathML(tex, display)
+	if err == nil {
+		return mathml
+	}
+	if conf.Math.Fallback == "mathjax" {
+		if display {
+			return `<span class="math-tex">\[` + escapeHTML(tex) + `\]</span>`
+		}
+		return `<span class="math-tex">\(` + escapeHTML(tex) + `\)</span>`
+	}
+	return fmt.Sprintf(`<code class="math-error" title="%s">%s</code>`, escapeHTML(err.Error()), escapeHTML(tex))
+}
+
+// replaceInlineMath 把一行中的公式替换为 MathML，fn 用于生成替换后的片段
+func replaceInlineMath(text string, fn func(tex string, display bool) string) string {
+	spans := findInlineMath(text)
+	if len(spans) == 0 {
+		return unescapeDollar(text)
+	}
+	var buf bytes.Buffer
+	last := 0
+	for _, s := range spans {
+		buf.WriteString(unescapeDollar(text[last:s[0]]))
+		raw := text[s[0]:s[1]]
+		if strings.HasPrefix(raw, "$$") {
+			buf.WriteString(fn(raw[2:len(raw)-2], true))
+		} else {
+			buf.WriteString(fn(raw[1:len(raw)-1], false))
+		}
+		last = s[1]
+	}
+	buf.WriteString(unescapeDollar(text[last:]))
+	return buf.String()
+}
+
+var escapedDollarRe = regexp.MustCompile("(`[^`]*`)|\\\\\\$")
+
+// unescapeDollar 把代码之外的 \$ 还原为 $
+func unescapeDollar(s string) string {
+	return escapedDollarRe.ReplaceAllStringFunc(s, func(m string) string {
+		if strings.HasPrefix(m, "`") {
+			return m
+		}
+		return "$"
+	})
+}
+
+// isMathBlockStart 判断一行是否开始一个行间公式块: 单独的 $$，或整行只有一个 $$...$$。
+// $$x$$ 后面还有文字的行按段落处理，其中的 $$...$$ 由 findInlineMath 识别。
+func isMathBlockStart(line string) bool {
+	t := strings.TrimSpace(line)
+	if t == "$$" {
+		return true
+	}
+	return len(t) > 4 && strings.HasPrefix(t, "$$") && strings.HasSuffix(t, "$$") && !strings.Contains(t[2:len(t)-2], "$$")
+}
+
+// collectMathBlock 从第 i 行开始收集 $$ ... $$ 之间的内容，返回公式和结束行的下标
+func collectMathBlock(lines []string, i int) (string, int, bool) {
+	first := strings.TrimPrefix(strings.TrimSpace(lines[i]), "$$")
+	if strings.HasSuffix(first, "$$") {
+		return strings.TrimSuffix(first, "$$"), i, true
+	}
+	parts := []string{first}
+	for j := i + 1; j < len(lines); j++ {
+		l := strings.TrimSpace(lines[j])
+		if strings.HasSuffix(l, "$$") {
+			parts = append(parts, strings.TrimSuffix(l, "$$"))
+			return strings.TrimSpace(strings.Join(parts, "\n")), j, true
+		}
+		parts = append(parts, l)
+	}
+	return strings.TrimSpace(strings.Join(parts, "\n")), len(lines) - 1, false
+}
+
+// checkMath 在渲染前检查全章的公式，对无法转换的公式给出带位置的诊断
+func checkMath(src source) {
+	if conf.Math.Disabled {
+		return
+	}
+	hint := ""
+	if conf.Math.Fallback == "mathjax" {
+		hint = "，将由浏览器端 MathJax 渲染"
+	}
+	report := func(pos srcPos, tex string, display bool) {
+		if _, err := texToMathML(tex, display); err != nil {
+			fmt.Printf("Warning: %s: 公式 %s 无法转换为 MathML: %v%s\n", pos, strconv.Quote(tex), err, hint)
+		}
+	}
+
+	// 引用块和脚注内的公式也要检查，先去掉行首的 > 和缩进
+	lines := make([]string, len(src.Lines))
+	for i, l := range src.Lines {
+		lines[i] = strings.TrimLeft(l, "> \t")
+	}
+
+	inFence := false
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if strings.HasPrefix(line, "```") {
+			inFence = !inFence
+			continue
+		}
+		if inFence {
+			continue
+		}
+		if isMathBlockStart(line) {
+			tex, end, closed := collectMathBlock(lines, i)
+			if !closed {
+				fmt.Printf("Warning: %s: $$ 公式块没有闭合\n", src.posAt(i))
+			}
+			report(src.posAt(i), tex, true)
+			i = end
+			continue
+		}
+		for _, s := range findInlineMath(line) {
+			raw := line[s[0]:s[1]]
+			if strings.HasPrefix(raw, "$$") {
+				report(src.posAt(i), raw[2:len(raw)-2], true)
+			} else {
+				report(src.posAt(i), raw[1:len(raw)-1], false)
+			}
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"mdbook-gen/internal/config"
+)
+
+func TestFindInlineMath(t *testing.T) {
+	tests := []struct {
+		name, text string
+		want       []string // 找到的公式 (含定界符)
+	}{
+		{"普通公式", "面积 $\\pi r^2$ 和 $x$", []string{"$\\pi r^2$", "$x$"}},
+		{"金额", "价格从 $5 涨到 $10", nil},
+		{"开始的 $ 后面是空格", "$ x$", nil},
+		{"结束的 $ 前面是空格", "$x $ 和", nil},
+		{"结束的 $ 后面是数字", "$x$1", nil},
+		{"转义的美元符号", "\\$x$ 和 \\$", nil},
+		{"公式中的转义", "$a\\$b$", []string{"$a\\$b$"}},
+		{"行内代码", "`$x$` 和 ``$y$``", nil},
+		{"不跨进行内代码", "$x `y$`", nil},
+		{"行内的行间公式", "见 $$x^2$$ 式", []string{"$$x^2$$"}},
+		{"空的 $$", "$$$$", nil},
+		{"行末的 $", "花了 5$", nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, s := range findInlineMath(tt.text) {
+				got = append(got, tt.text[s[0]:s[1]])
+			}
+			if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+				t.Errorf("findInlineMath(%q) = %q，应该是 %q", tt.text, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInlineMathRendering(t *testing.T) {
+	tests := []struct {
+		name, text string
+		want       []string
+		not        []string
+	}{
+		{
+			name: "金额保持原样",
+			text: "价格从 $5 涨到 $10",
+			want: []string{"价格从 $5 涨到 $10"},
+			not:  []string{"<math"},
+		},
+		{
+			name: "字面的美元符号",
+			text: "\\$x\\$ 元",
+			want: []string{"$x$ 元"},
+			not:  []string{"<math", "\\$"},
+		},
+		{
+			name: "行内代码中的 \\$ 不还原",
+			text: "`\\$x$`",
+			want: []string{"<code>\\$x$</code>"},
+			not:  []string{"<math"},
+		},
+		{
+			name: "公式中的下划线不是强调",
+			text: "$a_1 + b_2$",
+			want: []string{`display="inline"`, "<msub><mi>a</mi><mn>1</mn></msub>"},
+			not:  []string{"<em>"},
+		},
+		{
+			name: "行内的行间公式",
+			text: "$$x$$",
+			want: []string{`display="block"`},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setConfig(t, config.Config{})
+			out := processInline(tt.text)
+			for _, w := range tt.want {
+				if !strings.Contains(out, w) {
+					t.Errorf("processInline(%q) 中没有 %s:\n%s", tt.text, w, out)
+				}
+			}
+			for _, n := range tt.not {
+				if strings.Contains(out, n) {
+					t.Errorf("processInline(%q) 中不应该有 %s:\n%s", tt.text, n, out)
+				}
+			}
+		})
+	}
+}
+
+func TestMathDisabled(t *testing.T) {
+	setConfig(t, config.Config{Math: config.MathConfig{Disabled: true}})
+	if out := processInline("$x$"); strings.Contains(out, "<math") {
+		t.Errorf("关闭公式后仍然输出了 MathML: %s", out)
+	}
+}
+
+func TestRenderMathError(t *testing.T) {
+	tests := []struct {
+		fallback, want string
+	}{
+		{"", `<code class="math-error"`},
+		{"mathjax", `<span class="math-tex">\(\nosuchcommand\)</span>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.fallback, func(t *testing.T) {
+			setConfig(t, config.Config{Math: config.MathConfig{Fallback: tt.fallback}})
+			if _, err := texToMathML(`\nosuchcommand`, false); err == nil {
+				t.Fatal("不支持的命令应该返回错误")
+			}
+			if out := renderMath(`\nosuchcommand`, false); !strings.Contains(out, tt.want) {
+				t.Errorf("renderMath = %s，应该包含 %s", out, tt.want)
+			}
+		})
+	}
+}
+
+func TestCollectMathBlock(t *testing.T) {
+	tests := []struct {
+		name   string
+		lines  []string
+		tex    string
+		end    int
+		closed bool
+	}{
+		{"单行", []string{"$$x^2$$"}, "x^2", 0, true},
+		{"多行", []string{"$$", "a = b", "$$", "后文"}, "a = b", 2, true},
+		{"没有结束", []string{"$$", "a"}, "a", 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tex, end, closed := collectMathBlock(tt.lines, 0)
+			if tex != tt.tex || end != tt.end || closed != tt.closed {
+				t.Errorf("collectMathBlock = (%q, %d, %v)，应该是 (%q, %d, %v)", tex, end, closed, tt.tex, tt.end, tt.closed)
+			}
+		})
+	}
+}
+
+func TestIsMathBlockStart(t *testing.T) {
+	tests := []struct {
+		line string
+		want bool
+	}{
+		{"$$", true},
+		{"  $$  ", true},
+		{"$$x^2$$", true},
+		{"$$E=mc^2$$ 是质能方程。", false},
+		{"$$a$$ 和 $$b$$", false},
+		{"$$$$", false},
+		{"$$ x", false},
+		{"价格 $$5", false},
+	}
+	for _, tt := range tests {
+		if got := isMathBlockStart(tt.line); got != tt.want {
+			t.Errorf("isMathBlockStart(%q) = %v，应该是 %v", tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestDisplayMathFollowedByText(t *testing.T) {
+	md := "$$E=mc^2$$ 是质能方程。\n\n## 标题\n\n正文"
+	var out string
+	warnings := captureOutput(t, func() {
+		out = renderMarkdown(t, config.Config{}, md)
+		checkMath(testSource(md))
+	})
+	for _, w := range []string{`<p><math`, `display="block"`, "</math> 是质能方程。</p>", "<h2", ">标题", "<p>正文</p>"} {
+		if !strings.Contains(out, w) {
+			t.Errorf("输出中没有 %s:\n%s", w, out)
+		}
+	}
+	if strings.Contains(out, "<mo>#</mo>") || strings.Count(out, "<math") != 1 {
+		t.Errorf("公式吞掉了后面的内容:\n%s", out)
+	}
+	if warnings != "" {
+		t.Errorf("不应该有警告: %s", warnings)
+	}
+}
@@ -0,0 +1,43 @@
+package core
+
+import "fmt"
+
+// pageNeighbors 返回第 i 页的上一页和下一页，navigation.skip_contents 时跳过目录页
+func pageNeighbors(chapters []Chapter, i int) (prev, next *Chapter) {
+	skip := func(j int) bool {
+		return conf.Navigation.SkipContents && chapters[j].IsContents
+	}
+	for j := i - 1; j >= 0; j-- {
+		if !skip(j) {
+			prev = &chapters[j]
+			break
+		}
+	}
+	for j := i + 1; j < len(chapters); j++ {
+		if !skip(j) {
+			next = &chapters[j]
+			break
+		}
+	}
+	return prev, next
+}
+
+// navLinks 生成页眉、页脚的翻页链接，<head> 中的 <link rel> 和方向键翻页用的脚本
+type navLinks struct {
+	Header, Footer, Head, JS string
+}
+
+func renderNavLink(ch *Chapter, rel, label string) navLinks {
+	if ch == nil {
+		disabled := fmt.Sprintf(`<span class="disabled">%s</span>`, label)
+		return navLinks{Header: disabled, Footer: disabled}
+	}
+	title := escapeAttr(chapterLabel(*ch))
+	href := pageHref(ch.OutputFile)
+	return navLinks{
+		Header: fmt.Sprintf(`<a href="%s" rel="%s" title="%s">%s</a>`, href, rel, title, label),
+		Footer: fmt.Sprintf(`<a href="%s" rel="%s"><span class="nav-label">%s</span> <span class="nav-title">%s</span></a>`, href, rel, label, escapeHTML(chapterLabel(*ch))),
+		Head:   fmt.Sprintf("\n\t\t<link rel=\"%s\" href=\"%s\" title=\"%s\">", rel, href, title),
+		JS:     fmt.Sprintf(`window.location.href = "%s";`, href),
+	}
+}
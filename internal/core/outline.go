@@ -0,0 +1,73 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// 阅读速度: 中日韩文字按字计算，其它文字按词计算
+const (
+	cjkCharsPerMinute   = 300
+	latinWordsPerMinute = 200
+)
+
+// 不计入阅读时间的内容: 脚本和公式的 TeX 注释
+var readingSkipRe = regexp.MustCompile(`(?s)<script[\s>].*?</script>|<annotation[\s>].*?</annotation>`)
+
+// readingMinutes 估算一章的阅读时间 (分钟)，至少 1 分钟
+func readingMinutes(content string) int {
+	text := htmlToText(readingSkipRe.ReplaceAllString(content, " "))
+	chars, words := 0, 0
+	inWord := false
+	for _, r := range text {
+		switch {
+		case isCJK(r):
+			chars++
+			inWord = false
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if !inWord {
+				words++
+			}
+			inWord = true
+		default:
+			inWord = false
+		}
+	}
+	minutes := float64(chars)/cjkCharsPerMinute + float64(words)/latinWordsPerMinute
+	if minutes < 1 {
+		return 1
+	}
+	return int(minutes + 0.5)
+}
+
+// renderOutline 生成页面右侧的 "本页内容"，列出本章的 H2 和 H3，标题少于两个时不显示
+func renderOutline(ch Chapter) string {
+	var items []heading
+	for _, h := range ch.headings {
+		if h.Level == 2 || h.Level == 3 {
+			items = append(items, h)
+		}
+	}
+	if len(items) < 2 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString(`
+		<nav class="page-outline" id="page-outline" aria-label="本页内容">
+			<div class="page-outline-title">本页内容</div>
+			<ol>
+`)
+	for _, h := range items {
+		text := headingTitle(h.Text)
+		if h.Number != "" {
+			text = h.Number + " " + text
+		}
+		b.WriteString(fmt.Sprintf("<li class=\"outline-h%d\"><a href=\"#%s\">%s</a></li>\n", h.Level, h.ID, text))
+	}
+	b.WriteString(`			</ol>
+		</nav>`)
+	return b.String()
+}
@@ -0,0 +1,90 @@
+package core
+
+import "fmt"
+
+// highlight.js 的浅色和深色样式，按当前主题启用其中一个
+const (
+	hljsLightCSS = "https://cdnjs.cloudflare.com/ajax/libs/highlight.js/11.9.0/styles/intellij-light.min.css"
+	hljsDarkCSS  = "https://cdnjs.cloudflare.com/ajax/libs/highlight.js/11.9.0/styles/github-dark.min.css"
+)
+
+// defaultTheme 返回 theme.default，默认为 auto (跟随系统)
+func defaultTheme() string {
+	switch conf.Theme.Default {
+	case "":
+		return "auto"
+	case "auto", "light", "dark", "sepia":
+		return conf.Theme.Default
+	}
+	fmt.Printf("Warning: 未知的 theme.default 设置 %q，可选 auto、light、dark 或 sepia\n", conf.Theme.Default)
+	conf.Theme.Default = "auto"
+	return "auto"
+}
+
+// prefsHead 返回 <head> 中的代码高亮样式和恢复阅读设置的脚本。
+// 脚本必须在页面显示之前运行，否则切换主题时会先闪一下浅色页面。
+func prefsHead() string {
+	return fmt.Sprintf(`
+		<link rel="stylesheet" id="hljs-light" href="%s" media="(prefers-color-scheme: light)">
+		<link rel="stylesheet" id="hljs-dark" href="%s" media="(prefers-color-scheme: dark)">
+		<script>
+			(function () {
+				let prefs = {};
+				try { prefs = JSON.parse(localStorage.getItem('mdbook-gen.prefs')) || {}; } catch (e) {}
+				const root = document.documentElement;
+				const theme = prefs.theme || '%s';
+				if (theme !== 'auto') {
+					root.dataset.theme = theme;
+					const dark = theme === 'dark';
+					document.getElementById('hljs-light').media = dark ? 'not all' : 'all';
+					document.getElementById('hljs-dark').media = dark ? 'all' : 'not all';
+				}
+				if (prefs.font === 'serif') root.dataset.font = 'serif';
+				if (prefs.scale) root.style.setProperty('--font-scale', prefs.scale);
+				if (prefs.width) root.style.setProperty('--content-width', prefs.width + 'px');
+			})();
+		</script>`, hljsLightCSS, hljsDarkCSS, defaultTheme())
+}
+
+// prefsPanel 返回页眉中的阅读设置按钮和面板
+func prefsPanel() string {
+	return fmt.Sprintf(`
+				<div class="prefs">
+					<button class="prefs-toggle" id="prefs-toggle" aria-controls="prefs-panel" aria-expanded="false" aria-label="阅读设置">Aa</button>
+					<div class="prefs-panel" id="prefs-panel" data-default-theme="%s" hidden>
+						<div class="prefs-row">
+							<span class="prefs-label">主题</span>
+							<div class="prefs-options">
+								<button data-pref="theme" data-value="auto">自动</button>
+								<button data-pref="theme" data-value="light">浅色</button>
+								<button data-pref="theme" data-value="dark">深色</button>
+								<button data-pref="theme" data-value="sepia">护眼</button>
+							</div>
+						</div>
+						<div class="prefs-row">
+							<span class="prefs-label">字号</span>
+							<div class="prefs-options">
+								<button data-step="-1" aria-label="减小字号">A&minus;</button>
+								<span class="prefs-size">100%%</span>
+								<button data-step="1" aria-label="增大字号">A+</button>
+							</div>
+						</div>
+						<div class="prefs-row">
+							<span class="prefs-label">行宽</span>
+							<div class="prefs-options" data-default="760">
+								<button data-pref="width" data-value="640">窄</button>
+								<button data-pref="width" data-value="760">中</button>
+								<button data-pref="width" data-value="920">宽</button>
+							</div>
+						</div>
+						<div class="prefs-row">
+							<span class="prefs-label">字体</span>
+							<div class="prefs-options" data-default="sans">
+								<button data-pref="font" data-value="sans">无衬线</button>
+								<button data-pref="font" data-value="serif">衬线</button>
+							</div>
+						</div>
+						<button class="prefs-reset" data-reset>恢复默认</button>
+					</div>
+				</div>`, defaultTheme())
+}
@@ -0,0 +1,318 @@
+package core
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"html"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const defaultManifest = "book-manifest.json"
+
+// manifest 记录每个页面现在和以前的文件名，键是不随编号变化的页面标识 (见 pageKeys)。
+// 插入新章节后，后面章节的文件名都会变，靠它找到旧文件名并生成跳转页面。
+type manifest struct {
+	Pages map[string]*manifestPage `json:"pages"`
+}
+
+type manifestPage struct {
+	File   string   `json:"file"`
+	Anchor string   `json:"anchor,omitempty"` // 一级标题的 ID，源文件改名后靠它认出同一个页面
+	Old    []string `json:"old,omitempty"`
+}
+
+// writeRedirects 更新清单，并为旧文件名和 redirects.pages 中的地址生成跳转页面
+func writeRedirects(rootDir, outDir string, chapters []Chapter, rename map[string]string) error {
+	if conf.Redirects.Disabled {
+		return nil
+	}
+
+	// 现在的页面和它们的标题，旧地址和现在的页面重名时页面优先
+	current := map[string]bool{"index.html": true}
+	titles := make(map[string]string)
+	for _, ch := range chapters {
+		current[ch.OutputFile] = true
+		titles[ch.OutputFile] = ch.Title
+	}
+	for old, file := range rename {
+		titles[old] = titles[file]
+	}
+
+	m, err := updateManifest(rootDir, chapters, current)
+	if err != nil {
+		return err
+	}
+
+	redirects := make(map[string]string) // 旧文件名 -> 跳转目标
+	for _, page := range m.Pages {
+		for _, old := range page.Old {
+			redirects[old] = page.File
+		}
+	}
+	froms := make([]string, 0, len(conf.Redirects.Pages))
+	for from := range conf.Redirects.Pages {
+		froms = append(froms, from)
+	}
+	sort.Strings(froms)
+	for _, from := range froms {
+		to := conf.Redirects.Pages[from]
+		old := redirectSource(from)
+		target, suffix := to, ""
+		if i := strings.IndexAny(to, "?#"); i >= 0 {
+			target, suffix = to[:i], to[i:]
+		}
+		// 目标也可以写成不带编号的页面标识 (code)，章节重新编号后不用修改
+		if page := m.Pages[target]; page != nil {
+			target = page.File
+			to = target + suffix
+		}
+		switch {
+		case old == "":
+			fmt.Printf("Warning: 跳转地址 %q 不能指向书籍目录之外\n", from)
+		case current[old]:
+			fmt.Printf("Warning: 跳转地址 %q 是书中现有的页面，忽略\n", from)
+		case to == "":
+			fmt.Printf("Warning: 跳转地址 %q 缺少目标\n", from)
+		case titles[target] == "" && !strings.HasPrefix(to, "/") && !schemeRe.MatchString(to):
+			fmt.Printf("Warning: 跳转地址 %q 的目标 %s 不是书中的页面\n", from, to)
+		default:
+			redirects[old] = to
+		}
+	}
+	if len(redirects) == 0 {
+		return nil
+	}
+
+	olds := make([]string, 0, len(redirects))
+	for old := range redirects {
+		olds = append(olds, old)
+	}
+	sort.Strings(olds)
+	for _, old := range olds {
+		target := redirects[old]
+		file, _, _ := strings.Cut(target, "#")
+		file, _, _ = strings.Cut(file, "?")
+		path := filepath.Join(outDir, filepath.FromSlash(old))
+		os.MkdirAll(filepath.Dir(path), 0755)
+		page := redirectPage(relink(target, siteRoot(old), rename), titles[file])
+		if err := os.WriteFile(path, []byte(page), 0644); err != nil {
+			return fmt.Errorf("无法写入跳转页面 %s: %w", old, err)
+		}
+	}
+	return writeServerRedirects(outDir, olds, redirects, rename)
+}
+
+// pageKeys 返回各页面不随编号变化的标识: 去掉编号前缀的文件名 (01.00-intro -> intro)。
+// 两个页面去掉编号后重名时，后一个使用完整的文件名。
+func pageKeys(chapters []Chapter) []string {
+	keys := make([]string, len(chapters))
+	used := make(map[string]bool)
+	for i, ch := range chapters {
+		key := ch.ID
+		if m := numberedFileRe.FindStringSubmatch(ch.ID + ".html"); m != nil && !used[m[1]] {
+			key = m[1]
+		}
+		used[key] = true
+		keys[i] = key
+	}
+	return keys
+}
+
+// chapterAnchor 返回一章的一级标题的 ID，自动生成的页面没有时返回空字符串
+func chapterAnchor(ch Chapter) string {
+	for _, h := range ch.headings {
+		if h.Level == 1 {
+			return h.ID
+		}
+	}
+	return ""
+}
+
+// renamedPages 找出源文件改了名的页面: 新页面标识在上次的清单中没有，
+// 而上次的清单中有一个已经不在书中的页面，一级标题的 ID 和它相同。返回新标识 -> 旧标识。
+func renamedPages(prev manifest, keys []string, anchors []string) map[string]string {
+	current := make(map[string]bool)
+	for _, key := range keys {
+		current[key] = true
+	}
+	gone := make(map[string][]string) // 一级标题的 ID -> 已不在书中的页面标识
+	for key, p := range prev.Pages {
+		if !current[key] && p.Anchor != "" {
+			gone[p.Anchor] = append(gone[p.Anchor], key)
+		}
+	}
+	added := make(map[string][]string)
+	for i, key := range keys {
+		if prev.Pages[key] == nil && anchors[i] != "" {
+			added[anchors[i]] = append(added[anchors[i]], key)
+		}
+	}
+
+	renamed := make(map[string]string)
+	for anchor, news := range added {
+		// 有多个页面的标题相同时无法判断，不做处理
+		if len(news) == 1 && len(gone[anchor]) == 1 {
+			renamed[news[0]] = gone[anchor][0]
+		}
+	}
+	return renamed
+}
+
+// updateManifest 读取上次构建的清单，记下改名的页面，写回新的清单。
+// 已从书中删除的页面不再保留。
+func updateManifest(rootDir string, chapters []Chapter, current map[string]bool) (*manifest, error) {
+	name := conf.Redirects.Manifest
+	if name == "" {
+		name = defaultManifest
+	}
+	path := filepath.Join(rootDir, name)
+
+	var prev manifest
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("无法读取清单 %s: %w", name, err)
+	}
+	if err == nil {
+		if err := json.Unmarshal(data, &prev); err != nil {
+			fmt.Printf("Warning: 清单 %s 格式错误，重新生成: %v\n", name, err)
+			prev = manifest{}
+		}
+	}
+
+	keys := pageKeys(chapters)
+	anchors := make([]string, len(chapters))
+	for i, ch := range chapters {
+		anchors[i] = chapterAnchor(ch)
+	}
+	renamed := renamedPages(prev, keys, anchors)
+
+	m := &manifest{Pages: make(map[string]*manifestPage)}
+	for i, key := range keys {
+		file := chapters[i].OutputFile
+		page := &manifestPage{File: file, Anchor: anchors[i]}
+		p := prev.Pages[key]
+		if p == nil && renamed[key] != "" {
+			p = prev.Pages[renamed[key]]
+		}
+		if p != nil {
+			seen := make(map[string]bool)
+			for _, old := range append(p.Old, p.File) {
+				// 已被其他页面占用的旧文件名不再跳转
+				if old != "" && !current[old] && !seen[old] {
+					seen[old] = true
+					page.Old = append(page.Old, old)
+				}
+			}
+			sort.Strings(page.Old)
+		}
+		m.Pages[key] = page
+	}
+
+	out, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	out = append(out, '\n')
+	if !bytes.Equal(out, data) {
+		if err := os.WriteFile(path, out, 0644); err != nil {
+			return nil, fmt.Errorf("无法写入清单 %s: %w", name, err)
+		}
+	}
+	return m, nil
+}
+
+// redirectSource 把 redirects.pages 中的旧地址转换成输出目录中的文件名:
+// old/ 和 old 都对应 old/index.html。地址超出书籍目录时返回空字符串。
+func redirectSource(from string) string {
+	old := strings.TrimPrefix(from, "/")
+	if old == "" || strings.HasSuffix(old, "/") {
+		old += "index.html"
+	} else if !strings.HasSuffix(old, ".html") {
+		old += "/index.html"
+	}
+	old = filepath.ToSlash(filepath.Clean(old))
+	if old == ".." || strings.HasPrefix(old, "../") {
+		return ""
+	}
+	return old
+}
+
+// redirectPage 返回跳转到 link 的页面，脚本跳转时保留地址中的 #锚点
+func redirectPage(link, title string) string {
+	if title == "" {
+		title = link
+	}
+	js, _ := json.Marshal(link)
+	attr := html.EscapeString(link)
+	return fmt.Sprintf(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+	<meta charset="UTF-8">
+	<title>页面已移动</title>
+	<meta name="robots" content="noindex">
+	<meta http-equiv="refresh" content="0; url=%s">
+	<link rel="canonical" href="%s">
+	<script>
+		(function () {
+			const target = %s;
+			window.location.replace(target.indexOf('#') < 0 ? target + window.location.hash : target);
+		})();
+	</script>
+</head>
+<body>
+	<p>页面已移动到 <a href="%s">%s</a>。</p>
+</body>
+</html>
+`, attr, attr, js, attr, html.EscapeString(title))
+}
+
+// writeServerRedirects 按 redirects.server 生成服务器的跳转规则，
+// 地址都以 urls.base_url 中的路径开头 (默认为 /)
+func writeServerRedirects(outDir string, olds []string, redirects, rename map[string]string) error {
+	var name, format string
+	switch conf.Redirects.Server {
+	case "":
+		return nil
+	case "netlify":
+		// 旧地址上还有跳转页面，用 301! 让规则优先
+		name, format = "_redirects", "%s %s 301!\n"
+	case "nginx":
+		name, format = "redirects.map", "%q %q;\n"
+	default:
+		fmt.Printf("Warning: 未知的 redirects.server 设置 %q，可选 netlify 或 nginx\n", conf.Redirects.Server)
+		return nil
+	}
+
+	prefix := conf.URLs.BaseURL
+	if u, err := url.Parse(prefix); err == nil && u.Scheme != "" {
+		prefix = u.Path
+	}
+	if prefix = strings.Trim(prefix, "/"); prefix != "" {
+		prefix = "/" + prefix + "/"
+	} else {
+		prefix = "/"
+	}
+
+	var b strings.Builder
+	if name == "redirects.map" {
+		b.WriteString("# 在 http 中: map $uri $redirect_uri { include redirects.map; }\n")
+		b.WriteString("# 在 server 中: if ($redirect_uri) { return 301 $redirect_uri; }\n")
+	}
+	for _, old := range olds {
+		// 目录中的 index.html 通常用 old/ 访问
+		from := old
+		if from == "index.html" || strings.HasSuffix(from, "/index.html") {
+			from = strings.TrimSuffix(from, "index.html")
+		}
+		fmt.Fprintf(&b, format, prefix+from, relink(redirects[old], prefix, rename))
+	}
+	if err := os.WriteFile(filepath.Join(outDir, name), []byte(b.String()), 0644); err != nil {
+		return fmt.Errorf("无法写入 %s: %w", name, err)
+	}
+	return nil
+}
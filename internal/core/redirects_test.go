@@ -0,0 +1,247 @@
+package core
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mdbook-gen/internal/config"
+)
+
+// testPage 返回一个一级标题 ID 为 anchor 的章节
+func testPage(file, title, anchor string) Chapter {
+	return Chapter{
+		ID:         strings.TrimSuffix(file, ".html"),
+		Title:      title,
+		OutputFile: file,
+		headings:   []heading{{Level: 1, Text: title, ID: anchor}},
+	}
+}
+
+// buildRedirects 在 root 中按 chapters 生成一次跳转页面，返回输出目录
+func buildRedirects(t *testing.T, root string, chapters []Chapter) string {
+	t.Helper()
+	out := t.TempDir()
+	var err error
+	captureOutput(t, func() { err = writeRedirects(root, out, chapters, renameOutputs(chapters)) })
+	if err != nil {
+		t.Fatal(err)
+	}
+	return out
+}
+
+func readTestFile(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestRedirectsAcrossBuilds(t *testing.T) {
+	first := []Chapter{
+		testPage("01.00-intro.html", "简介", "简介"),
+		testPage("02.00-next.html", "下一步", "next"),
+		testPage("03.00-shell.html", "Shell", "shell"),
+	}
+	tests := []struct {
+		name   string
+		second []Chapter
+		want   map[string]string // 旧文件名 -> 跳转目标
+	}{
+		{
+			name: "插入新章节",
+			second: []Chapter{
+				testPage("01.00-intro.html", "简介", "简介"),
+				testPage("02.00-new.html", "新的一章", "新的一章"),
+				testPage("03.00-next.html", "下一步", "next"),
+				testPage("04.00-shell.html", "Shell", "shell"),
+			},
+			want: map[string]string{"02.00-next.html": "03.00-next.html", "03.00-shell.html": "04.00-shell.html"},
+		},
+		{
+			name: "源文件改名",
+			second: []Chapter{
+				testPage("01.00-intro.html", "简介", "简介"),
+				testPage("02.00-later.html", "下一步", "next"),
+				testPage("03.00-shell.html", "Shell", "shell"),
+			},
+			want: map[string]string{"02.00-next.html": "02.00-later.html"},
+		},
+		{
+			name: "删除页面",
+			second: []Chapter{
+				testPage("01.00-intro.html", "简介", "简介"),
+				testPage("02.00-shell.html", "Shell", "shell"),
+			},
+			want: map[string]string{"03.00-shell.html": "02.00-shell.html"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setConfig(t, config.Config{})
+			root := t.TempDir()
+			buildRedirects(t, root, first)
+			out := buildRedirects(t, root, tt.second)
+
+			entries, _ := os.ReadDir(out)
+			if len(entries) != len(tt.want) {
+				var names []string
+				for _, e := range entries {
+					names = append(names, e.Name())
+				}
+				t.Errorf("生成了 %q，应该只有 %d 个跳转页面", names, len(tt.want))
+			}
+			for old, target := range tt.want {
+				page := readTestFile(t, filepath.Join(out, old))
+				if !strings.Contains(page, `<meta http-equiv="refresh" content="0; url=`+target+`">`) {
+					t.Errorf("%s 没有跳转到 %s:\n%s", old, target, page)
+				}
+			}
+
+			var m manifest
+			if err := json.Unmarshal([]byte(readTestFile(t, filepath.Join(root, defaultManifest))), &m); err != nil {
+				t.Fatal(err)
+			}
+			if len(m.Pages) != len(tt.second) {
+				t.Errorf("清单中有 %d 个页面，应该是 %d 个", len(m.Pages), len(tt.second))
+			}
+			for _, ch := range tt.second {
+				if p := m.Pages[pageKeys([]Chapter{ch})[0]]; p == nil || p.File != ch.OutputFile || p.Anchor != chapterAnchor(ch) {
+					t.Errorf("清单中 %s 的记录不对: %+v", ch.OutputFile, p)
+				}
+			}
+		})
+	}
+}
+
+func TestRenamedPagesAmbiguous(t *testing.T) {
+	prev := manifest{Pages: map[string]*manifestPage{
+		"a": {File: "01.00-a.html", Anchor: "简介"},
+		"b": {File: "02.00-b.html", Anchor: "简介"},
+	}}
+	if got := renamedPages(prev, []string{"c"}, []string{"简介"}); len(got) != 0 {
+		t.Errorf("标题相同的页面不应该认为是改名: %v", got)
+	}
+	if got := renamedPages(prev, []string{"a", "c"}, []string{"简介", "简介"}); got["c"] != "b" {
+		t.Errorf("renamedPages = %v，应该是 c -> b", got)
+	}
+}
+
+func TestManualRedirects(t *testing.T) {
+	setConfig(t, config.Config{
+		URLs: config.URLsConfig{BaseURL: "/book/"},
+		Redirects: config.RedirectsConfig{Pages: map[string]string{
+			"old-guide/":   "shell#top",
+			"legacy.html":  "https://example.com/new?a=1&b=2",
+			"intro.html":   "/elsewhere/",
+			"01.00-a.html": "shell",
+			"../escape":    "shell",
+			"nowhere.html": "no-such-page",
+		}},
+	})
+	chapters := []Chapter{testPage("01.00-a.html", "A", "a"), testPage("02.00-shell.html", "Shell", "shell")}
+	root, out := t.TempDir(), t.TempDir()
+	var err error
+	warnings := captureOutput(t, func() { err = writeRedirects(root, out, chapters, nil) })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		file, target string
+	}{
+		{"old-guide/index.html", "/book/02.00-shell.html#top"},
+		{"legacy.html", "https://example.com/new?a=1&amp;b=2"},
+		{"intro.html", "/elsewhere/"},
+	}
+	for _, tt := range tests {
+		page := readTestFile(t, filepath.Join(out, filepath.FromSlash(tt.file)))
+		if !strings.Contains(page, `<link rel="canonical" href="`+tt.target+`">`) {
+			t.Errorf("%s 没有跳转到 %s:\n%s", tt.file, tt.target, page)
+		}
+	}
+	if !strings.Contains(readTestFile(t, filepath.Join(out, "legacy.html")), `const target = "https://example.com/new?a=1\u0026b=2";`) {
+		t.Error("脚本中的跳转地址不对")
+	}
+	for _, w := range []string{
+		`跳转地址 "01.00-a.html" 是书中现有的页面`,
+		`跳转地址 "../escape" 不能指向书籍目录之外`,
+		`跳转地址 "nowhere.html" 的目标 no-such-page 不是书中的页面`,
+	} {
+		if !strings.Contains(warnings, w) {
+			t.Errorf("没有警告 %s:\n%s", w, warnings)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(out, "nowhere.html")); err == nil {
+		t.Error("目标不存在时不应该生成跳转页面")
+	}
+}
+
+func TestServerRedirects(t *testing.T) {
+	tests := []struct {
+		server, base, file, want string
+	}{
+		{"netlify", "", "_redirects", "/guide/ /02.00-shell.html 301!\n/legacy.html https://example.com/ 301!\n"},
+		{"netlify", "https://example.com/docs/", "_redirects", "/docs/guide/ /docs/02.00-shell.html 301!\n"},
+		{"nginx", "", "redirects.map", "\"/guide/\" \"/02.00-shell.html\";\n\"/legacy.html\" \"https://example.com/\";\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.server+tt.base, func(t *testing.T) {
+			setConfig(t, config.Config{
+				URLs: config.URLsConfig{BaseURL: tt.base},
+				Redirects: config.RedirectsConfig{Server: tt.server, Pages: map[string]string{
+					"guide":       "shell",
+					"legacy.html": "https://example.com/",
+				}},
+			})
+			out := buildRedirects(t, t.TempDir(), []Chapter{testPage("02.00-shell.html", "Shell", "shell")})
+			if got := readTestFile(t, filepath.Join(out, tt.file)); !strings.Contains(got, tt.want) {
+				t.Errorf("%s:\n%s\n应该包含:\n%s", tt.file, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRedirectSource(t *testing.T) {
+	tests := []struct {
+		from, want string
+	}{
+		{"old.html", "old.html"},
+		{"/old.html", "old.html"},
+		{"old", "old/index.html"},
+		{"old/", "old/index.html"},
+		{"/", "index.html"},
+		{"a/../b.html", "b.html"},
+		{"../x.html", ""},
+	}
+	for _, tt := range tests {
+		if got := redirectSource(tt.from); got != tt.want {
+			t.Errorf("redirectSource(%q) = %q，应该是 %q", tt.from, got, tt.want)
+		}
+	}
+}
+
+func TestBrokenManifest(t *testing.T) {
+	setConfig(t, config.Config{})
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, defaultManifest), []byte("{"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	var err error
+	out := captureOutput(t, func() {
+		err = writeRedirects(root, t.TempDir(), []Chapter{testPage("01.00-a.html", "A", "a")}, nil)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(out, "清单 book-manifest.json 格式错误，重新生成") {
+		t.Errorf("没有警告: %q", out)
+	}
+	if !strings.Contains(readTestFile(t, filepath.Join(root, defaultManifest)), `"file": "01.00-a.html"`) {
+		t.Error("清单没有重新生成")
+	}
+}
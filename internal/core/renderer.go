@@ -31,6 +31,10 @@ type Chapter struct {
 	Content    template.HTML
 	IsContents bool
 	IsFront    bool
+	FrontIndex int // 前言页面的序号，从 1 开始，由 numberFrontMatter 设置
+
+	src      source    // 展开 include 后的 Markdown 内容
+	headings []heading // 渲染时收集的标题和 ID
 }
 
 func RenderBook(rootDir string, outputDirOverride string) error {
@@ -43,6 +47,7 @@ func RenderBook(rootDir string, outputDirOverride string) error {
 	if err := yaml.Unmarshal(confBody, &conf); err != nil {
 		return fmt.Errorf("解析 book.yaml 失败: %w", err)
 	}
+	compileTOCConfig()
 
 	files, _ := filepath.Glob(filepath.Join(rootDir, "book", "*.md"))
 	sort.Strings(files)
@@ -52,9 +57,12 @@ func RenderBook(rootDir string, outputDirOverride string) error {
 	subChapter := 0
 
 	for _, file := range files {
-		content, _ := os.ReadFile(file)
+		src, err := loadSource(rootDir, file)
+		if err != nil {
+			return err
+		}
 		filename := filepath.Base(file)
-		title := extractTitle(string(content))
+		title := extractTitle(src.String())
 
 		var outFile string
 		var number string
@@ -70,6 +78,7 @@ func RenderBook(rootDir string, outputDirOverride string) error {
 				InputFile:  file,
 				OutputFile: outFile,
 				IsFront:    true,
+				src:        src,
 			})
 		case "00.01-contents.md":
 			outFile = "00.01-contents.html"
@@ -80,6 +89,7 @@ func RenderBook(rootDir string, outputDirOverride string) error {
 				InputFile:  file,
 				OutputFile: outFile,
 				IsContents: true,
+				src:        src,
 			})
 		default:
 			re := regexp.MustCompile(`^(\d+)-(.*?)\.md$`)
@@ -102,6 +112,7 @@ func RenderBook(rootDir string, outputDirOverride string) error {
 				InputFile:  file,
 				OutputFile: outFile,
 				Category:   cat,
+				src:        src,
 			})
 		}
 	}
@@ -138,30 +149,88 @@ func RenderBook(rootDir string, outputDirOverride string) error {
 	if len(cssContent) > 0 {
 		os.WriteFile(filepath.Join(outDir, "assets", "css", "main.css"), cssContent, 0644)
 	}
+	if !conf.Search.Disabled {
+		copyScript(outDir, "search.js")
+	}
+	if conf.Sidebar.Enabled {
+		copyScript(outDir, "sidebar.js")
+	}
+	if !conf.Theme.NoPanel {
+		copyScript(outDir, "prefs.js")
+	}
+	if conf.Reading.Outline || conf.Reading.Progress {
+		copyScript(outDir, "reading.js")
+	}
 
-	for i, ch := range chapters {
-		mdContent, _ := os.ReadFile(ch.InputFile)
+	// 先渲染所有章节的正文，图表编号和交叉引用需要看到全书之后才能确定
+	for i := range chapters {
+		if chapters[i].IsContents {
+			// 00.01-contents.md 的内容显示在目录上方
+			chapters[i].Content = template.HTML(renderChapter(contentsIntro(chapters[i].src), "", false))
+			continue
+		}
+		chapters[i].Content = template.HTML(renderChapter(chapters[i].src, chapters[i].Number, chapters[i].IsFront))
+		chapters[i].headings = chapterHeadings.list
+	}
+	chapters = addContentsPages(chapters)
+	numberFrontMatter(chapters)
+	figures := numberFigures(chapters)
 
-		var htmlContent string
-		if ch.IsContents {
-			htmlContent = generateTOC(chapters)
-		} else {
-			htmlContent = markdownToBookHTML(string(mdContent), ch.Number, ch.IsFront)
+	bib, err := loadBibliography(rootDir)
+	if err != nil {
+		return err
+	}
+	if bib != nil {
+		refs, err := bib.resolveCitations(chapters)
+		if err != nil {
+			return err
 		}
+		if refs != nil {
+			chapters = append(chapters, *refs)
+		}
+	}
 
-		prev := ""
-		if i > 0 {
-			prev = chapters[i-1].OutputFile
+	gloss, err := loadGlossary(rootDir)
+	if err != nil {
+		return err
+	}
+	if gloss != nil {
+		for i := range chapters {
+			if !chapters[i].IsContents {
+				gloss.link(&chapters[i])
+			}
 		}
-		next := ""
-		if i < len(chapters)-1 {
-			next = chapters[i+1].OutputFile
+		chapters = append(chapters, gloss.page())
+	}
+	chapters = append(chapters, figureListPages(figures)...)
+	if index := buildIndex(chapters); index != nil {
+		chapters = append(chapters, *index)
+	}
+
+	rename := renameOutputs(chapters)
+	landing := landingPage(chapters)
+	for i, ch := range chapters {
+		htmlContent := string(ch.Content)
+		if ch.IsContents {
+			htmlContent = generateTOC(chapters, htmlContent)
 		}
 
+		prev, next := pageNeighbors(chapters, i)
 		pageHTML := buildFullPage(ch, htmlContent, prev, next, chapters)
-		os.WriteFile(filepath.Join(outDir, ch.OutputFile), []byte(pageHTML), 0644)
-		if ch.IsFront {
-			os.WriteFile(filepath.Join(outDir, "index.html"), []byte(pageHTML), 0644)
+		outPath := filepath.Join(outDir, ch.OutputFile)
+		os.MkdirAll(filepath.Dir(outPath), 0755)
+		os.WriteFile(outPath, []byte(resolveLinks(pageHTML, ch.OutputFile, rename)), 0644)
+		if ch.OutputFile == landing {
+			os.WriteFile(filepath.Join(outDir, "index.html"), []byte(resolveLinks(pageHTML, "index.html", rename)), 0644)
+		}
+	}
+	if err := writeRedirects(rootDir, outDir, chapters, rename); err != nil {
+		return err
+	}
+
+	if !conf.Search.Disabled {
+		if err := writeSearchIndex(chapters, outDir); err != nil {
+			return err
 		}
 	}
 
@@ -169,132 +238,256 @@ func RenderBook(rootDir string, outputDirOverride string) error {
 	return nil
 }
 
+// copyScript 把内置的页面脚本复制到 assets/js
+func copyScript(outDir, name string) {
+	os.MkdirAll(filepath.Join(outDir, "assets", "js"), 0755)
+	js, err := templates.Assets.ReadFile(name)
+	if err != nil {
+		fmt.Printf("Warning: Could not read embedded %s\n", name)
+		return
+	}
+	os.WriteFile(filepath.Join(outDir, "assets", "js", name), js, 0644)
+}
+
+// scriptTag 返回加载本书脚本的 <script> 标签
+func scriptTag(src string) string {
+	return fmt.Sprintf("\n\t\t<script src=\"%s\"></script>", pageHref(src))
+}
+
 func extractTitle(content string) string {
 	lines := strings.Split(content, "\n")
 	for _, line := range lines {
 		line = strings.TrimSpace(line)
 		if strings.HasPrefix(line, "# ") {
-			return strings.TrimPrefix(line, "# ")
+			title, _ := splitHeadingID(strings.TrimPrefix(line, "# "))
+			return strings.TrimSpace(indexRe.ReplaceAllString(title, ""))
 		}
 	}
 	return "Untitled"
 }
 
+var headingNumberRe = regexp.MustCompile(`^\s*(?:第\s*[\d一二三四五六七八九十百零]+\s*[章节部篇]\s*[：:、.]?|\d+(?:\.\d+)+\.?|\d+\.)\s*`)
+
 func slugify(s string) string {
-	s = regexp.MustCompile(`^([第\d\.\s章节：]+)`).ReplaceAllString(s, "")
+	s = indexRe.ReplaceAllString(s, "")
+	// 去掉 "第 3 章："、"3.2 " 这样的编号，ID 不随章节编号变化；"2024 年" 这样的数字保留。
+	// 标题只有编号 (如 "第一章") 时保留编号。
+	if slug := slugText(headingNumberRe.ReplaceAllString(s, "")); slug != "" {
+		return slug
+	}
+	return slugText(s)
+}
+
+var (
+	// 未设置 headings.slug 时 ID 中只保留小写字母、数字、汉字和连字符，与以前生成的锚点一致
+	slugStripRe = regexp.MustCompile(`[^a-z0-9\p{Han}-]`)
+	// keep-unicode 保留各种文字的字母和数字，例如 café、かな、привет
+	slugUnicodeStripRe = regexp.MustCompile(`[^\p{L}\p{M}\p{N}-]`)
+	slugDashRe         = regexp.MustCompile(`-+`)
+)
+
+func slugText(s string) string {
+	strip := slugStripRe
+	switch conf.Headings.Slug {
+	case "":
+	case "keep-unicode", "unicode":
+		strip = slugUnicodeStripRe
+	case "ascii-transliteration", "ascii":
+		s = transliterate(s, false)
+	case "pinyin":
+		s = transliterate(s, true)
+	default:
+		fmt.Printf("Warning: 未知的 headings.slug 设置 %q，可选 keep-unicode、ascii-transliteration 或 pinyin\n", conf.Headings.Slug)
+		conf.Headings.Slug = "keep-unicode"
+		strip = slugUnicodeStripRe
+	}
 	s = strings.ToLower(s)
 	s = strings.ReplaceAll(s, " ", "-")
-	// 只保留字母数字和中文
-	s = regexp.MustCompile(`[^a-z0-9\p{Han}-]`).ReplaceAllString(s, "")
-	s = regexp.MustCompile(`-+`).ReplaceAllString(s, "-")
+	s = strip.ReplaceAllString(s, "")
+	s = slugDashRe.ReplaceAllString(s, "-")
 	return strings.Trim(s, "-")
 }
 
-func generateTOC(chapters []Chapter) string {
-	var buf bytes.Buffer
-	buf.WriteString("<h1 id=\"contents\">目录</h1>\n\n<nav epub:type=\"toc\">\n<ol>\n")
+// tocEntry 是目录中的一章，目录页和侧边栏共用
+type tocEntry struct {
+	Label    string // "1. 简介"，自动生成的页面没有章号
+	Href     string
+	Part     string    // 从这一章开始的部分 (categories)
+	Sub      bool      // 子章节，例如 1.1.
+	Sections []heading // 章内 toc.depth 以内的标题
+}
 
+// tocEntries 按顺序列出目录中的章节，不包括目录页本身。前言只在 withFront 时列出。
+func tocEntries(chapters []Chapter, withFront bool) []tocEntry {
+	var entries []tocEntry
 	for _, ch := range chapters {
-		if ch.IsContents || ch.IsFront {
+		if ch.IsContents || (ch.IsFront && !withFront) {
 			continue
 		}
 
+		// 自动生成的页面 (插图目录等) 没有章号
+		if ch.Number == "" {
+			entries = append(entries, tocEntry{Label: chapterLabel(ch), Href: ch.OutputFile})
+			continue
+		}
+
+		// Sub-sections (H2, H3) collected while rendering the chapter
+		var sections []heading
+		for _, h := range ch.headings {
+			if h.Level >= 2 && h.Level <= conf.TOC.Depth {
+				if h.Number != "" && !conf.TOC.HideNumbers {
+					h.Text = h.Number + " " + h.Text
+				}
+				sections = append(sections, h)
+			}
+		}
+
+		entries = append(entries, tocEntry{
+			Label:    chapterLabel(ch),
+			Href:     ch.OutputFile,
+			Part:     ch.Category,
+			Sub:      strings.Count(ch.Number, ".") > 1,
+			Sections: sections,
+		})
+	}
+	return entries
+}
+
+// generateTOC 生成目录页，intro 是 00.01-contents.md 中的说明文字
+func generateTOC(chapters []Chapter, intro string) string {
+	var buf bytes.Buffer
+	buf.WriteString("<h1 id=\"contents\">目录</h1>\n\n")
+	buf.WriteString(intro)
+	buf.WriteString("<nav epub:type=\"toc\">\n<ol>\n")
+
+	for _, e := range tocEntries(chapters, conf.TOC.FrontMatter) {
 		class := ""
 		// If it's a sub-section (e.g., 1.1.), apply indent based on file structure (future proofing)
-		if strings.Count(ch.Number, ".") > 1 {
+		if e.Sub {
 			class = ` class="indent"`
 		}
 
-		// Simplify title display
-		title := ch.Title
-		title = regexp.MustCompile(`^第\s*\d+\s*章[：:]\s*`).ReplaceAllString(title, "")
-
-		// Remove trailing dot from number for display if present
-		displayNumber := strings.TrimSuffix(ch.Number, ".")
-
 		// Output format: 1. Introduction
-		buf.WriteString(fmt.Sprintf("<li%s><a href=\"%s\">%s. %s</a></li>\n", class, ch.OutputFile, displayNumber, title))
-
-		// Scan for sub-sections (H2) in the markdown file
-		content, err := os.ReadFile(ch.InputFile)
-		if err == nil {
-			lines := strings.Split(string(content), "\n")
-			for _, line := range lines {
-				if strings.HasPrefix(line, "## ") {
-					h2Title := strings.TrimSpace(strings.TrimPrefix(line, "## "))
-					id := slugify(h2Title)
-					buf.WriteString(fmt.Sprintf("<li class=\"indent\"><a href=\"%s#%s\">%s</a></li>\n", ch.OutputFile, id, h2Title))
-				}
+		buf.WriteString(fmt.Sprintf("<li%s><a href=\"%s\">%s</a></li>\n", class, pageHref(e.Href), escapeHTML(e.Label)))
+		for _, h := range e.Sections {
+			class := "indent"
+			if h.Level == 3 {
+				class = "indent-2"
 			}
+			buf.WriteString(fmt.Sprintf("<li class=\"%s\"><a href=\"%s\">%s</a></li>\n", class, pageHref(e.Href+"#"+h.ID), headingTitle(h.Text)))
 		}
 	}
 	buf.WriteString("</ol>\n</nav>\n")
 	return buf.String()
 }
 
-func buildFullPage(ch Chapter, content, prev, next string, chapters []Chapter) string {
+func buildFullPage(ch Chapter, content string, prev, next *Chapter, chapters []Chapter) string {
 	// Breadcrumbs
-	breadcrumb := fmt.Sprintf(`<a href="00.00-front-matter.html">%s</a>`, conf.Title)
+	breadcrumb := fmt.Sprintf(`<a href="%s">%s</a>`, pageHref("index.html"), escapeHTML(conf.Title))
 	if !ch.IsFront {
 		if ch.Category != "" {
-			breadcrumb += fmt.Sprintf(` <span class="crumbs">&rsaquo; %s</span>`, ch.Category)
+			breadcrumb += fmt.Sprintf(` <span class="crumbs">&rsaquo; %s</span>`, escapeHTML(ch.Category))
 		}
 		if !ch.IsContents {
-			breadcrumb += fmt.Sprintf(` <span class="crumbs">&rsaquo; %s</span>`, ch.Title)
+			breadcrumb += fmt.Sprintf(` <span class="crumbs">&rsaquo; %s</span>`, escapeHTML(ch.Title))
 		} else {
 			breadcrumb += ` <span class="crumbs">&rsaquo; 目录</span>`
 		}
 	}
 
 	// Navigation
-	prevLink := `<span class="disabled">上一章</span>`
-	prevJS := ""
-	if prev != "" {
-		prevLink = fmt.Sprintf(`<a href="%s">上一章</a>`, prev)
-		prevJS = fmt.Sprintf(`window.location.href = "%s";`, prev)
-	}
-	nextLink := `<span class="disabled">下一章</span>`
-	nextJS := ""
-	if next != "" {
-		nextLink = fmt.Sprintf(`<a href="%s">下一章</a>`, next)
-		nextJS = fmt.Sprintf(`window.location.href = "%s";`, next)
-	}
+	contents := pageHref("00.01-contents.html")
+	prevNav := renderNavLink(prev, "prev", "上一章")
+	nextNav := renderNavLink(next, "next", "下一章")
 
 	// Chapter indicator
 	chapterDiv := ""
 	if ch.Number != "" {
 		chapterDiv = fmt.Sprintf(`<div class="chapter">第 %s 章</div>`, strings.TrimSuffix(ch.Number, "."))
+		if conf.Reading.Time {
+			chapterDiv += fmt.Sprintf("\n\t\t\t<div class=\"reading-time\">约 %d 分钟读完</div>", readingMinutes(content))
+		}
+	}
+
+	// 只有存在无法在构建时转换的公式，且开启了客户端兜底时才加载 MathJax
+	head := prevNav.Head + nextNav.Head
+	if conf.Math.Fallback == "mathjax" && strings.Contains(content, `class="math-tex"`) {
+		head += `
+		<script>window.MathJax = { options: { processHtmlClass: 'math-tex', ignoreHtmlClass: '.*' } };</script>
+		<script defer src="https://cdn.jsdelivr.net/npm/mathjax@3/es5/tex-chtml.js"></script>`
+	}
+
+	// 全文搜索: 搜索框在页眉中，索引在第一次使用时加载
+	searchBox, scripts := "", ""
+	if !conf.Search.Disabled {
+		searchBox = `
+				<div class="search" role="search">
+					<input type="search" id="search-input" placeholder="搜索 (/)" aria-label="搜索" autocomplete="off">
+					<div id="search-results" hidden></div>
+				</div>`
+		scripts += scriptTag("assets/js/search.js")
+	}
+
+	// 主题和阅读设置
+	prefs := ""
+	if !conf.Theme.NoPanel {
+		prefs = prefsPanel()
+		scripts += scriptTag("assets/js/prefs.js")
+	}
+
+	// 侧边栏: 隐藏状态要在页面显示之前恢复，否则会闪一下
+	bodyClass, sidebar, sidebarToggle := "", "", ""
+	if conf.Sidebar.Enabled {
+		head += `
+		<script>try { if (localStorage.getItem('mdbook-gen.sidebar') === 'hidden') document.documentElement.classList.add('sidebar-hidden'); } catch (e) {}</script>`
+		bodyClass = ` class="has-sidebar"`
+		sidebar = renderSidebar(chapters, ch)
+		sidebarToggle = `<button class="sidebar-toggle" id="sidebar-toggle" aria-controls="sidebar" aria-label="显示或隐藏目录">&#9776;</button>
+					`
+		scripts += scriptTag("assets/js/sidebar.js")
+	}
+
+	// 阅读进度条和右侧的本页目录
+	outline, progressBar := "", ""
+	if conf.Reading.Outline {
+		outline = renderOutline(ch)
+	}
+	if conf.Reading.Progress {
+		progressBar = `
+		<div class="reading-progress" id="reading-progress"></div>`
+	}
+	if outline != "" || conf.Reading.Progress {
+		scripts += scriptTag("assets/js/reading.js")
 	}
 
 	return fmt.Sprintf(`<!DOCTYPE html>
 <html lang="zh-CN">
 	<head>
-		<meta charset="utf-8">
+		<meta charset="utf-8">%s
 		<meta http-equiv="x-ua-compatible" content="ie=edge">
 		<meta name="author" content="%s">
 		<meta name="copyright" content="%s">
 		<title>%s &mdash; %s</title>
 		<meta name="viewport" content="width=device-width, initial-scale=1, shrink-to-fit=no">
-		<link rel="stylesheet" type="text/css" href="assets/css/main.css">
-		<link rel="stylesheet" href="https://cdnjs.cloudflare.com/ajax/libs/highlight.js/11.9.0/styles/intellij-light.min.css">
+		<link rel="stylesheet" type="text/css" href="%s">%s
 		<script src="https://cdnjs.cloudflare.com/ajax/libs/highlight.js/11.9.0/highlight.min.js"></script>
 		<script src="https://cdnjs.cloudflare.com/ajax/libs/highlight.js/11.9.0/languages/go.min.js"></script>
 		<script src="https://cdnjs.cloudflare.com/ajax/libs/highlight.js/11.9.0/languages/bash.min.js"></script>
 		<script>hljs.highlightAll();</script>
 		<script type="module">
 			import mermaid from 'https://cdn.jsdelivr.net/npm/mermaid@11/dist/mermaid.esm.min.mjs';
-			mermaid.initialize({ startOnLoad: true });
-		</script>
+			mermaid.initialize({ startOnLoad: true, theme: getComputedStyle(document.documentElement).colorScheme === 'dark' ? 'dark' : 'default' });
+		</script>%s
 	</head>
-	<body>
+	<body%s>%s%s
 		<header>
 			<div class="wrapper">
 				<div>
-					%s
-				</div>
+					%s%s
+				</div>%s%s
 				<div>
 					&lsaquo; %s
-					&middot; <a href="00.01-contents.html">目录</a> &middot;
+					&middot; <a href="%s">目录</a> &middot;
 					%s &rsaquo;
 				</div>
 			</div>
@@ -302,14 +495,14 @@ func buildFullPage(ch Chapter, content, prev, next string, chapters []Chapter) s
 		<main class="wrapper text">
 			%s
 			%s
-		</main>
+		</main>%s
 		<footer>
 			<div class="wrapper">
 				<div>
 					&lsaquo; %s
 				</div>
 				<div>
-					<a href="00.01-contents.html">目录</a>
+					<a href="%s">目录</a>
 				</div>
 				<div>
 					%s &rsaquo;
@@ -319,6 +512,11 @@ func buildFullPage(ch Chapter, content, prev, next string, chapters []Chapter) s
 		<script>
 			document.onkeydown = function(evt) {
 				evt = evt || window.event;
+				// 输入时和按住修饰键时 (例如 Alt+← 是浏览器的后退) 不翻页
+				if (/^(INPUT|TEXTAREA|SELECT)$/.test(evt.target.tagName) || evt.target.isContentEditable ||
+					evt.altKey || evt.ctrlKey || evt.metaKey || evt.shiftKey) {
+					return;
+				}
 				switch (evt.keyCode) {
 					case 37:
 						%s
@@ -329,6 +527,53 @@ func buildFullPage(ch Chapter, content, prev, next string, chapters []Chapter) s
 				}
 			};
 
+			// Tabbed code groups: groups with the same data-group share the selected tab,
+			// and the choice is remembered across pages in localStorage
+			const selectTab = (group, label) => {
+				document.querySelectorAll('.tabs').forEach(tabs => {
+					if (tabs.dataset.group !== group || !tabs.querySelector(':scope > .tab-panel[data-label="' + CSS.escape(label) + '"]')) {
+						return;
+					}
+					tabs.querySelectorAll(':scope > .tab-list > .tab').forEach(tab => {
+						tab.setAttribute('aria-selected', tab.dataset.label === label);
+					});
+					tabs.querySelectorAll(':scope > .tab-panel').forEach(panel => {
+						panel.hidden = panel.dataset.label !== label;
+					});
+				});
+			};
+			document.querySelectorAll('.tabs').forEach(tabs => {
+				const group = tabs.dataset.group;
+				// 页面中是依次排列的代码块，在这里加上标签栏，只显示第一页
+				const list = document.createElement('div');
+				list.className = 'tab-list';
+				list.setAttribute('role', 'tablist');
+				tabs.querySelectorAll(':scope > .tab-panel').forEach((panel, i) => {
+					const tab = document.createElement('button');
+					tab.type = 'button';
+					tab.className = 'tab';
+					tab.setAttribute('role', 'tab');
+					tab.dataset.label = panel.dataset.label;
+					tab.setAttribute('aria-selected', i === 0);
+					tab.textContent = panel.dataset.label;
+					list.appendChild(tab);
+					panel.setAttribute('role', 'tabpanel');
+					panel.hidden = i > 0;
+				});
+				tabs.prepend(list);
+				tabs.querySelectorAll(':scope > .tab-list > .tab').forEach(tab => {
+					tab.addEventListener('click', () => {
+						selectTab(group, tab.dataset.label);
+						try { localStorage.setItem('mdbook-gen.tab.' + group, tab.dataset.label); } catch (e) {}
+					});
+				});
+				let saved = null;
+				try { saved = localStorage.getItem('mdbook-gen.tab.' + group); } catch (e) {}
+				if (saved) {
+					selectTab(group, saved);
+				}
+			});
+
 			// Copy button functionality
 			document.querySelectorAll('figure.code, figure.bash').forEach(container => {
 				const button = document.createElement('button');
@@ -338,7 +583,11 @@ func buildFullPage(ch Chapter, content, prev, next string, chapters []Chapter) s
 				container.appendChild(button);
 
 				button.addEventListener('click', () => {
-					const code = container.querySelector('pre').innerText;
+					// Terminal sessions: copy the commands only, without prompts or output
+					const commands = container.querySelectorAll('.command');
+					const code = commands.length > 0
+						? Array.from(commands, el => el.textContent).filter(Boolean).join('\n')
+						: container.querySelector('pre').innerText;
 					navigator.clipboard.writeText(code).then(() => {
 						button.classList.add('copied');
 						button.innerHTML = '<svg xmlns="http://www.w3.org/2000/svg" width="24" height="24" viewBox="0 0 24 24" fill="none" stroke="currentColor" stroke-width="2" stroke-linecap="round" stroke-linejoin="round"><polyline points="20 6 9 17 4 12"></polyline></svg>';
@@ -351,18 +600,33 @@ func buildFullPage(ch Chapter, content, prev, next string, chapters []Chapter) s
 					});
 				});
 			});
-		</script>
+		</script>%s
 	</body>
 </html>
-`, conf.Author, conf.Copyright, ch.Title, conf.Title, breadcrumb, prevLink, nextLink, chapterDiv, content, prevLink, nextLink, prevJS, nextJS)
+`, cspMeta(), escapeAttr(conf.Author), escapeAttr(conf.Copyright), escapeHTML(ch.Title), escapeHTML(conf.Title), pageHref("assets/css/main.css"), prefsHead(), head, bodyClass, progressBar, sidebar, sidebarToggle, breadcrumb, searchBox, prefs, prevNav.Header, contents, nextNav.Header, chapterDiv, content, outline, prevNav.Footer, contents, nextNav.Footer, prevNav.JS, nextNav.JS, scripts)
 }
 
-func markdownToBookHTML(md string, chapterNum string, isFront bool) string {
+// renderChapter 渲染一整章: 先做需要看到全章内容的预处理 (脚注定义)，
+// 再逐块渲染，最后处理依赖全章顺序的编号
+func renderChapter(src source, chapterNum string, isFront bool) string {
+	checkMath(src)
+	chapterHeadings = newHeadingIDs()
+	if !isFront {
+		chapterHeadings.prefix = strings.TrimSuffix(chapterNum, ".")
+	}
+	body, footnotes := extractFootnotes(src)
+	body, chapterLinkRefs = extractLinkRefs(body)
+	html := markdownToBookHTML(body, chapterNum, isFront)
+	return resolveFootnotes(html, footnotes, chapterNum, isFront)
+}
+
+func markdownToBookHTML(src source, chapterNum string, isFront bool) string {
 	var buf bytes.Buffer
 
-	lines := strings.Split(md, "\n")
+	lines := src.Lines
 	inCodeBlock := false
 	inTable := false
+	var table source
 
 	// List tracking
 	inList := false
@@ -370,45 +634,54 @@ func markdownToBookHTML(md string, chapterNum string, isFront bool) string {
 	currentListTag := "" // "ul" or "ol"
 
 	var codeFileName string
-	var codeLang string
-	_ = codeLang // avoid unused error
+	var fence codeInfo
+	var codeLines []string
+
+	// 连续的带 tab 属性的代码块先收集起来，遇到其它内容时再作为一组输出
+	var tabs []codeTab
+	tabGroup := ""
 
 	for i := 0; i < len(lines); i++ {
 		line := lines[i]
 		trimmed := strings.TrimSpace(line)
 
-		// 1. 代码块处理
+		if len(tabs) > 0 && !inCodeBlock && trimmed != "" && !isTabFence(line) {
+			buf.WriteString(renderTabGroup(tabGroup, tabs))
+			tabs = nil
+			tabGroup = ""
+		}
+
+		// 1. 代码块处理 (整块收集后再输出，行号和高亮行需要知道全部内容)
 		if strings.HasPrefix(line, "```") {
 			// Tables MUST close if we start a code block
 			if inTable {
-				buf.WriteString("</tbody>\n</table>\n")
+				buf.WriteString(renderTable(table, "", "", false))
+				table = source{}
 				inTable = false
 			}
 
 			if inCodeBlock {
-				if codeLang == "mermaid" {
-					buf.WriteString("</div>\n")
+				if fence.Tab != "" {
+					tabs = append(tabs, codeTab{Label: fence.Tab, HTML: renderFence(fence, codeFileName, codeLines)})
+					if tabGroup == "" {
+						tabGroup = fence.Group
+					}
 				} else {
-					buf.WriteString("</code></pre>\n</figure>\n")
+					buf.WriteString(renderFence(fence, codeFileName, codeLines))
 				}
 				inCodeBlock = false
 				codeFileName = ""
-				codeLang = ""
+				codeLines = nil
 			} else {
-				lang := strings.TrimPrefix(line, "```")
-				if lang == "" {
-					lang = "text"
-				}
-				codeLang = lang
+				fence = parseCodeInfo(strings.TrimPrefix(line, "```"), src.posAt(i))
+				inCodeBlock = true
 
-				if lang == "mermaid" {
-					buf.WriteString("<div class=\"mermaid\">\n")
-					inCodeBlock = true
+				if fence.Lang == "mermaid" {
 					continue
 				}
 
-				// 检查下一行是否是文件名注释
-				if i+1 < len(lines) {
+				// 检查下一行是否是文件名注释 (显式 title 时不再猜测)
+				if fence.Title == "" && i+1 < len(lines) {
 					nextLine := strings.TrimSpace(lines[i+1])
 					if strings.HasPrefix(nextLine, "// ") || strings.HasPrefix(nextLine, "# ") {
 						parts := strings.Fields(nextLine)
@@ -418,23 +691,12 @@ func markdownToBookHTML(md string, chapterNum string, isFront bool) string {
 						}
 					}
 				}
-
-				buf.WriteString(fmt.Sprintf("<figure class=\"code %s\">\n", lang))
-				if codeFileName != "" {
-					buf.WriteString(fmt.Sprintf("<figcaption>File: %s</figcaption>\n", codeFileName))
-				}
-				buf.WriteString(fmt.Sprintf("<pre><code class=\"language-%s\">", lang))
-				inCodeBlock = true
 			}
 			continue
 		}
 
 		if inCodeBlock {
-			if codeLang == "mermaid" {
-				buf.WriteString(line + "\n")
-			} else {
-				buf.WriteString(escapeHTML(line) + "\n")
-			}
+			codeLines = append(codeLines, line)
 			continue
 		}
 
@@ -489,76 +751,56 @@ func markdownToBookHTML(md string, chapterNum string, isFront bool) string {
 			continue
 		}
 
-		// 2. 表格处理
-		if strings.HasPrefix(trimmed, "|") && strings.Contains(line, "|") {
-			if !inTable {
-				buf.WriteString("<table>\n<thead>\n" + renderTableRow(line, "th") + "</thead>\n<tbody>\n")
-				inTable = true
-				if i+1 < len(lines) && strings.Contains(lines[i+1], "---") {
+		// 2. 表格处理 (GFM 表格，整张表收集后再输出，表格之后可以跟一行 "Table: 标题")
+		if !inTable && isTableStart(src, i) {
+			inTable = true
+			table = source{Lines: []string{lines[i], lines[i+1]}, Pos: []srcPos{src.posAt(i), src.posAt(i + 1)}}
+			i++
+			continue
+		}
+		if inTable && (isTableRow(line) || strings.HasSuffix(strings.TrimSpace(table.Lines[len(table.Lines)-1]), `\`)) {
+			table.Lines = append(table.Lines, line)
+			table.Pos = append(table.Pos, src.posAt(i))
+			continue
+		} else if inTable {
+			caption, label, ok := parseTableCaption(trimmed)
+			if !ok && trimmed == "" && i+1 < len(lines) {
+				if caption, label, ok = parseTableCaption(strings.TrimSpace(lines[i+1])); ok {
 					i++
 				}
-			} else {
-				buf.WriteString(renderTableRow(line, "td"))
 			}
-			continue
-		} else if inTable {
-			buf.WriteString("</tbody>\n</table>\n")
+			buf.WriteString(renderTable(table, caption, label, ok))
+			table = source{}
 			inTable = false
+			if ok {
+				continue
+			}
 		}
 
-		// 3. 引用块 -> Aside
-		if strings.HasPrefix(line, "> ") {
-			var quoteLines []string
-			for ; i < len(lines) && strings.HasPrefix(lines[i], "> "); i++ {
-				quoteLines = append(quoteLines, strings.TrimPrefix(lines[i], "> "))
+		// 3. 引用块 -> Aside 提示框或 blockquote
+		if strings.HasPrefix(line, ">") {
+			var quote source
+			for ; i < len(lines) && strings.HasPrefix(lines[i], ">"); i++ {
+				quote.Lines = append(quote.Lines, stripQuoteMarker(lines[i]))
+				quote.Pos = append(quote.Pos, src.posAt(i))
 			}
 			i--
 
-			fullContent := strings.Join(quoteLines, "\n")
-			class := "note"
-			label := "Note:"
-			if strings.Contains(fullContent, "💡") || strings.Contains(fullContent, "提示") {
-				class = "hint"
-				label = "Hint:"
-			} else if strings.Contains(fullContent, "⚠️") || strings.Contains(fullContent, "注意") || strings.Contains(fullContent, "警告") || strings.Contains(fullContent, "重要") {
-				class = "important"
-				label = "Important:"
-			}
-			fullContent = regexp.MustCompile(`[💡⚠️❌✅]`).ReplaceAllString(fullContent, "")
-			fullContent = strings.TrimSpace(fullContent)
-
-			htmlContent := ""
-			for _, qline := range strings.Split(fullContent, "\n") {
-				qline = strings.TrimSpace(qline)
-				if qline != "" {
-					htmlContent += processInline(qline) + "<br>\n"
-				}
-			}
-			htmlContent = strings.TrimSuffix(htmlContent, "<br>\n")
-
-			buf.WriteString(fmt.Sprintf("<aside class=\"%s\"><p>\n<strong>%s</strong> %s\n</p></aside>\n", class, label, htmlContent))
+			buf.WriteString(renderBlockquote(quote, chapterNum, isFront))
 			continue
 		}
 
-		// 4. 标题
-		if strings.HasPrefix(line, "# ") {
-			title := strings.TrimPrefix(line, "# ")
-			buf.WriteString(fmt.Sprintf("<h1 id=\"%s\">%s</h1>\n\n", slugify(title), processInline(title)))
-			continue
-		}
-		if strings.HasPrefix(line, "## ") {
-			title := strings.TrimPrefix(line, "## ")
-			buf.WriteString(fmt.Sprintf("<h2 id=\"%s\">%s</h2>\n\n", slugify(title), processInline(title)))
+		// 行间公式 $$ ... $$
+		if !conf.Math.Disabled && isMathBlockStart(line) {
+			tex, end, _ := collectMathBlock(lines, i)
+			i = end
+			buf.WriteString("<div class=\"math-display\">" + renderMath(tex, true) + "</div>\n\n")
 			continue
 		}
-		if strings.HasPrefix(line, "### ") {
-			title := strings.TrimPrefix(line, "### ")
-			buf.WriteString(fmt.Sprintf("<h3 id=\"%s\">%s</h3>\n\n", slugify(title), processInline(title)))
-			continue
-		}
-		if strings.HasPrefix(line, "#### ") {
-			title := strings.TrimPrefix(line, "#### ")
-			buf.WriteString(fmt.Sprintf("<h4 id=\"%s\">%s</h4>\n\n", slugify(title), processInline(title)))
+
+		// 4. 标题
+		if m := headingRe.FindStringSubmatch(line); m != nil {
+			buf.WriteString(renderHeading(len(m[1]), m[2], src.posAt(i)))
 			continue
 		}
 
@@ -598,17 +840,48 @@ func markdownToBookHTML(md string, chapterNum string, isFront bool) string {
 			} else {
 				content = regexp.MustCompile(`^\d+\. `).ReplaceAllString(trimmed, "")
 			}
-			buf.WriteString(fmt.Sprintf("<li><p>%s</p>", processInline(content)))
+			// 任务列表: - [ ] 待办 / - [x] 已完成
+			if m := taskItemRe.FindStringSubmatch(content); m != nil {
+				checked := ""
+				if m[1] != " " {
+					checked = " checked"
+				}
+				buf.WriteString(fmt.Sprintf("<li class=\"task-list-item\"><p><input type=\"checkbox\" disabled%s> %s</p>", checked, processInline(m[2])))
+			} else {
+				buf.WriteString(fmt.Sprintf("<li><p>%s</p>", processInline(content)))
+			}
 			inLI = true
 			continue
 		}
 
-		// 8. 普通段落
+		// 8. 普通段落 (以两个空格或 \ 结尾的行是硬换行，和下一行合并成同一段)
 		if trimmed != "" {
-			buf.WriteString(fmt.Sprintf("<p>%s</p>\n\n", processInline(line)))
+			para := processInline(strings.TrimSpace(line))
+			for isHardBreak(lines[i]) && i+1 < len(lines) && isParagraphLine(lines[i+1]) {
+				i++
+				para = strings.TrimSuffix(para, `\`) + "<br />\n" + processInline(strings.TrimSpace(lines[i]))
+			}
+			buf.WriteString(fmt.Sprintf("<p>%s</p>\n\n", strings.TrimSuffix(para, `\`)))
 		}
 	}
 
+	// 先输出标签组: 没有闭合的带 tab 的代码块是组中的最后一页，其它代码块在组的后面
+	if inCodeBlock {
+		fmt.Printf("Warning: %s: 代码块没有闭合\n", src.posAt(len(lines)-1))
+		if fence.Tab != "" {
+			tabs = append(tabs, codeTab{Label: fence.Tab, HTML: renderFence(fence, codeFileName, codeLines)})
+			if tabGroup == "" {
+				tabGroup = fence.Group
+			}
+			inCodeBlock = false
+		}
+	}
+	if len(tabs) > 0 {
+		buf.WriteString(renderTabGroup(tabGroup, tabs))
+	}
+	if inCodeBlock {
+		buf.WriteString(renderFence(fence, codeFileName, codeLines))
+	}
 	if inLI {
 		buf.WriteString("</li>\n")
 	}
@@ -616,35 +889,33 @@ func markdownToBookHTML(md string, chapterNum string, isFront bool) string {
 		buf.WriteString(fmt.Sprintf("</%s>\n", currentListTag))
 	}
 	if inTable {
-		buf.WriteString("</tbody>\n</table>\n")
+		buf.WriteString(renderTable(table, "", "", false))
 	}
 
 	return buf.String()
 }
 
-func renderTableRow(row string, tag string) string {
-	parts := strings.Split(strings.Trim(row, "|"), "|")
-	var buf bytes.Buffer
-	buf.WriteString("<tr>\n")
-	for _, p := range parts {
-		buf.WriteString(fmt.Sprintf("<%s>%s</%s>\n", tag, processInline(strings.TrimSpace(p)), tag))
-	}
-	buf.WriteString("</tr>\n")
-	return buf.String()
+var headingRe = regexp.MustCompile(`^(#{1,4}) (.*)$`)
+
+var taskItemRe = regexp.MustCompile(`^\[([ xX])\]\s+(.*)$`)
+
+// isHardBreak 判断一行是否以硬换行结束 (两个以上空格或反斜杠)
+func isHardBreak(line string) bool {
+	return strings.HasSuffix(line, "  ") && strings.TrimSpace(line) != "" || strings.HasSuffix(line, `\`)
 }
 
-func processInline(text string) string {
-	// 图片
-	text = regexp.MustCompile(`!\[([^\]]*)\]\(([^)]+)\)`).ReplaceAllString(text, `<figure class="img"><img src="$2" alt="$1"></figure>`)
-	// 粗体
-	text = regexp.MustCompile(`\*\*([^*]+)\*\*`).ReplaceAllString(text, "<strong>$1</strong>")
-	// 斜体
-	text = regexp.MustCompile(`\*([^*]+)\*`).ReplaceAllString(text, "<em>$1</em>")
-	// 行内代码
-	text = regexp.MustCompile("`([^`]+)`").ReplaceAllString(text, "<code>$1</code>")
-	// 链接
-	text = regexp.MustCompile(`\[([^\]]+)\]\(([^)]+)\)`).ReplaceAllString(text, `<a href="$2">$1</a>`)
-	return text
+// isParagraphLine 判断一行能否作为上一段的延续，空行和其它块的开头不能
+func isParagraphLine(line string) bool {
+	t := strings.TrimSpace(line)
+	if t == "" || t == "---" || t == "***" || isMathBlockStart(t) {
+		return false
+	}
+	for _, prefix := range []string{"#", ">", "```", "- ", "* ", "|", "<!--"} {
+		if strings.HasPrefix(t, prefix) {
+			return false
+		}
+	}
+	return !regexp.MustCompile(`^\d+\. `).MatchString(t)
 }
 
 func escapeHTML(s string) string {
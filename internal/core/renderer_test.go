@@ -0,0 +1,59 @@
+package core
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"mdbook-gen/internal/config"
+)
+
+// setConfig 在测试期间使用配置 c，测试结束后恢复
+func setConfig(t *testing.T, c config.Config) {
+	t.Helper()
+	saved := conf
+	conf = c
+	compileTOCConfig()
+	t.Cleanup(func() {
+		conf = saved
+		compileTOCConfig()
+	})
+}
+
+// testSource 把 md 作为 test.md 的内容，警告中带有行号
+func testSource(md string) source {
+	var src source
+	for i, line := range strings.Split(md, "\n") {
+		src.Lines = append(src.Lines, line)
+		src.Pos = append(src.Pos, srcPos{"test.md", i + 1})
+	}
+	return src
+}
+
+// renderMarkdown 用配置 c 渲染一章 Markdown
+func renderMarkdown(t *testing.T, c config.Config, md string) string {
+	t.Helper()
+	setConfig(t, c)
+	return renderChapter(testSource(md), "1.", false)
+}
+
+// captureOutput 返回 fn 打印到标准输出的内容 (警告信息)
+func captureOutput(t *testing.T, fn func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	saved := os.Stdout
+	os.Stdout = w
+	done := make(chan string)
+	go func() {
+		out, _ := io.ReadAll(r)
+		done <- string(out)
+	}()
+	defer func() { os.Stdout = saved }()
+	fn()
+	w.Close()
+	return <-done
+}
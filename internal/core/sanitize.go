@@ -0,0 +1,180 @@
+package core
+
+import (
+	"fmt"
+	"html"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// raw_html: sanitize 时允许的标签
+var allowedTags = map[string]bool{
+	"a": true, "abbr": true, "b": true, "bdi": true, "bdo": true, "blockquote": true, "br": true, "caption": true,
+	"cite": true, "code": true, "col": true, "colgroup": true, "dd": true, "del": true, "details": true, "dfn": true,
+	"div": true, "dl": true, "dt": true, "em": true, "figcaption": true, "figure": true, "h1": true, "h2": true,
+	"h3": true, "h4": true, "h5": true, "h6": true, "hr": true, "i": true, "img": true, "ins": true, "kbd": true,
+	"li": true, "mark": true, "ol": true, "p": true, "pre": true, "q": true, "rp": true, "rt": true, "ruby": true,
+	"s": true, "samp": true, "small": true, "span": true, "strong": true, "sub": true, "summary": true, "sup": true,
+	"table": true, "tbody": true, "td": true, "tfoot": true, "th": true, "thead": true, "time": true, "tr": true,
+	"u": true, "ul": true, "var": true, "wbr": true,
+}
+
+// 所有标签都允许的属性，另外 data-* 和 aria-* 也允许
+var allowedGlobalAttrs = map[string]bool{"id": true, "class": true, "title": true, "lang": true, "dir": true, "role": true}
+
+// 只在特定标签上允许的属性
+var allowedTagAttrs = map[string]map[string]bool{
+	"a":          {"href": true, "name": true, "target": true, "rel": true},
+	"img":        {"src": true, "alt": true, "width": true, "height": true, "loading": true},
+	"td":         {"colspan": true, "rowspan": true, "align": true},
+	"th":         {"colspan": true, "rowspan": true, "align": true, "scope": true},
+	"col":        {"span": true},
+	"colgroup":   {"span": true},
+	"ol":         {"start": true, "reversed": true, "type": true},
+	"li":         {"value": true},
+	"time":       {"datetime": true},
+	"q":          {"cite": true},
+	"blockquote": {"cite": true},
+	"del":        {"cite": true, "datetime": true},
+	"ins":        {"cite": true, "datetime": true},
+	"details":    {"open": true},
+}
+
+// 值为 URL 的属性，需要检查协议
+var urlAttrs = map[string]bool{"href": true, "src": true, "cite": true}
+
+var (
+	tagNameRe = regexp.MustCompile(`^<(/?)([A-Za-z][A-Za-z0-9-]*)`)
+	attrRe    = regexp.MustCompile("([^\\s\"'<>/=]+)(?:\\s*=\\s*(?:\"([^\"]*)\"|'([^']*)'|([^\\s\"'=<>`]+)))?")
+	schemeRe  = regexp.MustCompile(`^([A-Za-z][A-Za-z0-9+.-]*):`)
+)
+
+// filterRawHTML 按 html.raw 的设置处理正文中的一个 HTML 标签或注释
+func filterRawHTML(tag string) string {
+	switch conf.HTML.Raw {
+	case "allow":
+		return tag
+	case "escape":
+		return escapeHTML(tag)
+	case "", "sanitize":
+	default:
+		fmt.Printf("Warning: 未知的 html.raw 设置 %q，使用 sanitize\n", conf.HTML.Raw)
+		conf.HTML.Raw = "sanitize"
+	}
+
+	if strings.HasPrefix(tag, "<!--") {
+		return ""
+	}
+	m := tagNameRe.FindStringSubmatch(tag)
+	name := strings.ToLower(m[2])
+	if !isAllowedTag(name) {
+		return escapeHTML(tag)
+	}
+	if m[1] == "/" {
+		return "</" + name + ">"
+	}
+
+	var b strings.Builder
+	b.WriteString("<" + name)
+	rest := strings.TrimSuffix(strings.TrimSuffix(tag[len(m[0]):], ">"), "/")
+	for _, a := range attrRe.FindAllStringSubmatch(rest, -1) {
+		attr := strings.ToLower(a[1])
+		if !isAllowedAttr(name, attr) {
+			continue
+		}
+		value := html.UnescapeString(a[2] + a[3] + a[4])
+		if urlAttrs[attr] {
+			value = safeURL(value, name == "img")
+		}
+		if attr == "href" || attr == "src" {
+			value = pageHref(value)
+		}
+		if a[0] == a[1] {
+			b.WriteString(" " + attr) // 布尔属性，例如 <details open>
+			continue
+		}
+		b.WriteString(fmt.Sprintf(` %s="%s"`, attr, escapeAttr(value)))
+	}
+	if strings.HasSuffix(tag, "/>") {
+		b.WriteString(" /")
+	}
+	b.WriteString(">")
+	return b.String()
+}
+
+func isAllowedTag(name string) bool {
+	if allowedTags[name] {
+		return true
+	}
+	for _, t := range conf.HTML.AllowedTags {
+		if strings.EqualFold(t, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func isAllowedAttr(tag, attr string) bool {
+	if strings.HasPrefix(attr, "on") {
+		return false
+	}
+	return allowedGlobalAttrs[attr] || allowedTagAttrs[tag][attr] ||
+		strings.HasPrefix(attr, "data-") || strings.HasPrefix(attr, "aria-")
+}
+
+// safeURL 检查链接的协议，相对路径和 html.allowed_schemes 中的协议保持不变，
+// 其它 (如 javascript:) 替换为 "#"。图片另外允许 data:image/。
+func safeURL(u string, image bool) string {
+	// 浏览器会忽略协议中的空白和控制字符，也会解码实体 (jav&#x61;script:)
+	clean := strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) || unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, html.UnescapeString(u))
+	m := schemeRe.FindStringSubmatch(clean)
+	if m == nil {
+		return u
+	}
+	scheme := strings.ToLower(m[1])
+	if image && scheme == "data" && strings.HasPrefix(strings.ToLower(clean), "data:image/") {
+		return u
+	}
+	schemes := conf.HTML.AllowedSchemes
+	if len(schemes) == 0 {
+		schemes = []string{"http", "https", "mailto", "tel", "ftp"}
+	}
+	for _, s := range schemes {
+		if strings.EqualFold(s, scheme) {
+			return u
+		}
+	}
+	fmt.Printf("Warning: 链接 %q 使用了不允许的协议 %s:，已替换为 #\n", u, scheme)
+	return "#"
+}
+
+// escapeText 转义正文中的 < 和 >，& 由 escapeAmpersands 单独处理以保留合法的实体
+func escapeText(s string) string {
+	return strings.NewReplacer("<", "&lt;", ">", "&gt;").Replace(s)
+}
+
+// 内置的 Content-Security-Policy，允许页面模板用到的 CDN 和内联脚本。
+// main.css 从 Google Fonts 引入字体: 样式表在 fonts.googleapis.com，字体文件在 fonts.gstatic.com。
+const defaultCSP = "default-src 'self'; " +
+	"script-src 'self' 'unsafe-inline' https://cdnjs.cloudflare.com https://cdn.jsdelivr.net; " +
+	"style-src 'self' 'unsafe-inline' https://cdnjs.cloudflare.com https://fonts.googleapis.com; " +
+	"img-src 'self' data: https:; font-src 'self' data: https://cdn.jsdelivr.net https://fonts.gstatic.com; " +
+	"object-src 'none'; base-uri 'self'; form-action 'none'"
+
+// cspMeta 返回页面头部的 CSP meta 标签，html.csp 为空时不输出
+func cspMeta() string {
+	csp := conf.HTML.CSP
+	if csp == "" {
+		return ""
+	}
+	if csp == "default" {
+		csp = defaultCSP
+	}
+	return fmt.Sprintf("\n\t\t<meta http-equiv=\"Content-Security-Policy\" content=\"%s\">", escapeAttr(csp))
+}
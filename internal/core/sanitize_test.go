@@ -0,0 +1,207 @@
+package core
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"mdbook-gen/internal/config"
+	"mdbook-gen/templates"
+)
+
+func TestSafeURL(t *testing.T) {
+	tests := []struct {
+		name, url string
+		image     bool
+		schemes   []string
+		want      string
+	}{
+		{name: "相对路径", url: "02.00-next.html#top", want: "02.00-next.html#top"},
+		{name: "https", url: "https://example.com", want: "https://example.com"},
+		{name: "mailto", url: "mailto:a@example.com", want: "mailto:a@example.com"},
+		{name: "javascript", url: "javascript:alert(1)", want: "#"},
+		{name: "大写", url: "JavaScript:alert(1)", want: "#"},
+		{name: "实体", url: "jav&#x61;script:alert(1)", want: "#"},
+		{name: "空白和控制字符", url: " java\tscript\x01:alert(1)", want: "#"},
+		{name: "vbscript", url: "vbscript:msgbox", want: "#"},
+		{name: "链接中的 data:", url: "data:text/html,<script>", want: "#"},
+		{name: "图片中的 data:image/", url: "data:image/png;base64,AAAA", image: true, want: "data:image/png;base64,AAAA"},
+		{name: "图片中的 data:text/", url: "data:text/html,x", image: true, want: "#"},
+		{name: "自定义协议", url: "obsidian://open", schemes: []string{"obsidian"}, want: "obsidian://open"},
+		{name: "自定义协议之外", url: "https://example.com", schemes: []string{"obsidian"}, want: "#"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setConfig(t, config.Config{HTML: config.HTMLConfig{AllowedSchemes: tt.schemes}})
+			var got string
+			out := captureOutput(t, func() { got = safeURL(tt.url, tt.image) })
+			if got != tt.want {
+				t.Errorf("safeURL(%q) = %q，应该是 %q", tt.url, got, tt.want)
+			}
+			if (got == "#") != strings.Contains(out, "不允许的协议") {
+				t.Errorf("警告 %q 与结果 %q 不一致", out, got)
+			}
+		})
+	}
+}
+
+func TestFilterRawHTML(t *testing.T) {
+	tests := []struct {
+		name, tag        string
+		escape, sanitize string // allow 时原样输出
+	}{
+		{
+			name:     "javascript 链接",
+			tag:      `<a href="javascript:alert(1)">`,
+			escape:   `&lt;a href="javascript:alert(1)"&gt;`,
+			sanitize: `<a href="#">`,
+		},
+		{
+			name:     "实体编码的 javascript",
+			tag:      `<a href='jav&#x61;script:alert(1)' title=x>`,
+			escape:   `&lt;a href='jav&amp;#x61;script:alert(1)' title=x&gt;`,
+			sanitize: `<a href="#" title="x">`,
+		},
+		{
+			name:     "事件属性",
+			tag:      `<img src="/img/a.png" onerror="alert(1)" ONLOAD=x alt="图">`,
+			escape:   `&lt;img src="/img/a.png" onerror="alert(1)" ONLOAD=x alt="图"&gt;`,
+			sanitize: `<img src="/img/a.png" alt="图">`,
+		},
+		{
+			name:     "不允许的标签",
+			tag:      `<script>`,
+			escape:   `&lt;script&gt;`,
+			sanitize: `&lt;script&gt;`,
+		},
+		{
+			name:     "结束标签",
+			tag:      `</SPAN>`,
+			escape:   `&lt;/SPAN&gt;`,
+			sanitize: `</span>`,
+		},
+		{
+			name:     "注释",
+			tag:      `<!-- 注释 -->`,
+			escape:   `&lt;!-- 注释 --&gt;`,
+			sanitize: ``,
+		},
+		{
+			name:     "布尔属性和 style",
+			tag:      `<details open data-x="1" style="color: red">`,
+			escape:   `&lt;details open data-x="1" style="color: red"&gt;`,
+			sanitize: `<details open data-x="1">`,
+		},
+		{
+			name:     "自闭合的 data:image/ 图片",
+			tag:      `<img src="data:image/gif;base64,R0lG" />`,
+			escape:   `&lt;img src="data:image/gif;base64,R0lG" /&gt;`,
+			sanitize: `<img src="data:image/gif;base64,R0lG" />`,
+		},
+	}
+	for _, tt := range tests {
+		for _, mode := range []struct{ raw, want string }{{"allow", tt.tag}, {"escape", tt.escape}, {"sanitize", tt.sanitize}, {"", tt.sanitize}} {
+			t.Run(tt.name+"/"+mode.raw, func(t *testing.T) {
+				setConfig(t, config.Config{HTML: config.HTMLConfig{Raw: mode.raw}})
+				var got string
+				captureOutput(t, func() { got = filterRawHTML(tt.tag) })
+				if got != mode.want {
+					t.Errorf("filterRawHTML(%q) = %q，应该是 %q", tt.tag, got, mode.want)
+				}
+			})
+		}
+	}
+}
+
+func TestAllowedTags(t *testing.T) {
+	setConfig(t, config.Config{HTML: config.HTMLConfig{AllowedTags: []string{"Video"}}})
+	if got, want := filterRawHTML(`<video onplay="x" class="demo">`), `<video class="demo">`; got != want {
+		t.Errorf("filterRawHTML = %q，应该是 %q", got, want)
+	}
+}
+
+func TestMarkdownLinkSchemes(t *testing.T) {
+	tests := []struct {
+		name, md, want string
+	}{
+		{"链接", "[点击](javascript:alert(1))", `<a href="#">点击</a>`},
+		{"实体编码的链接", "[点击](jav&#x61;script:alert(1))", `<a href="#">点击</a>`},
+		{"自动链接", "<javascript:alert(1)>", "&lt;javascript:alert(1)&gt;"},
+		{"图片", "![图](javascript:alert(1))", `src="#"`},
+		{"data:image/ 图片", "![图](data:image/png;base64,AAAA)", `src="data:image/png;base64,AAAA"`},
+	}
+	for _, tt := range tests {
+		for _, raw := range []string{"allow", "escape", "sanitize"} {
+			t.Run(tt.name+"/"+raw, func(t *testing.T) {
+				var out string
+				captureOutput(t, func() { out = renderMarkdown(t, config.Config{HTML: config.HTMLConfig{Raw: raw}}, tt.md) })
+				if !strings.Contains(out, tt.want) {
+					t.Errorf("输出中没有 %s:\n%s", tt.want, out)
+				}
+				if strings.Contains(out, `"javascript:`) {
+					t.Errorf("输出中有 javascript: 链接:\n%s", out)
+				}
+			})
+		}
+	}
+}
+
+var (
+	cspScriptRe = regexp.MustCompile(`<script[^>]*\ssrc="(https://[^/"]+)|import [^'"]*from '(https://[^/']+)`)
+	cspStyleRe  = regexp.MustCompile(`<link[^>]*rel="stylesheet"[^>]*href="(https://[^/"]+)|@import url\('(https://[^/']+)`)
+)
+
+// TestDefaultCSPAllowsTemplateOrigins 检查内置 CSP 允许页面模板和 main.css 引用的所有外部地址
+func TestDefaultCSPAllowsTemplateOrigins(t *testing.T) {
+	setConfig(t, config.Config{
+		Title: "书名",
+		HTML:  config.HTMLConfig{CSP: "default"},
+		Math:  config.MathConfig{Fallback: "mathjax"},
+	})
+	ch := Chapter{Title: "第一章", OutputFile: "01.00-intro.html", Number: "1."}
+	page := buildFullPage(ch, `<span class="math-tex">\(x\)</span>`, nil, nil, []Chapter{ch})
+	css, err := templates.Assets.ReadFile("main.css")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(page, `<meta http-equiv="Content-Security-Policy"`) {
+		t.Fatal("页面中没有 CSP")
+	}
+
+	policy := make(map[string][]string)
+	for _, d := range strings.Split(defaultCSP, ";") {
+		if f := strings.Fields(d); len(f) > 0 {
+			policy[f[0]] = f[1:]
+		}
+	}
+	allowed := func(directive, origin string) bool {
+		for _, s := range policy[directive] {
+			if s == origin || s == "https:" {
+				return true
+			}
+		}
+		return false
+	}
+
+	check := func(directive string, re *regexp.Regexp, text string) int {
+		n := 0
+		for _, m := range re.FindAllStringSubmatch(text, -1) {
+			origin := m[1] + m[2]
+			n++
+			if !allowed(directive, origin) {
+				t.Errorf("%s 不允许 %s", directive, origin)
+			}
+			// Google Fonts 的样式表从 fonts.gstatic.com 加载字体文件
+			if origin == "https://fonts.googleapis.com" && !allowed("font-src", "https://fonts.gstatic.com") {
+				t.Error("font-src 不允许 https://fonts.gstatic.com")
+			}
+		}
+		return n
+	}
+	if check("script-src", cspScriptRe, page) == 0 {
+		t.Error("页面中没有找到外部脚本")
+	}
+	if check("style-src", cspStyleRe, page+string(css)) == 0 {
+		t.Error("页面中没有找到外部样式表")
+	}
+}
@@ -0,0 +1,156 @@
+package core
+
+import (
+	"encoding/json"
+	"fmt"
+	"html"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// searchDoc 是搜索索引中的一个条目，对应章节中两个标题之间的一段内容
+type searchDoc struct {
+	Page    string `json:"p"`
+	Anchor  string `json:"a,omitempty"` // 最近的标题的 ID
+	Title   string `json:"t"`           // 小节标题
+	Chapter string `json:"c"`           // 章节标题
+	Body    string `json:"b"`           // 纯文本，用于显示摘要
+}
+
+// searchIndex 是输出到 search-index.json 的内容。
+// Index 为倒排索引: 词 -> [文档序号, 权重, 文档序号, 权重, ...]
+type searchIndex struct {
+	Docs  []searchDoc      `json:"docs"`
+	Index map[string][]int `json:"index"`
+}
+
+var (
+	searchHeadingRe = regexp.MustCompile(`(?s)<h([1-4]) id="([^"]*)"[^>]*>(.*?)</h[1-4]>`)
+	// 不参与搜索的内容: 代码块、脚本、公式的 TeX 注释、标题后的 # 链接和脚注回链
+	searchSkipRe = regexp.MustCompile(`(?s)<pre[\s>].*?</pre>|<script[\s>].*?</script>|<annotation[\s>].*?</annotation>|<a class="permalink"[^>]*>#</a>|<a [^>]*class="footnote-backref"[^>]*>.*?</a>`)
+	searchTagRe  = regexp.MustCompile(`<[^>]*>`)
+)
+
+// 标题中的词权重更高
+const searchTitleWeight = 5
+
+// writeSearchIndex 为所有章节生成搜索索引，输出 search-index.json，
+// 以及供 file:// 直接打开时使用的 search-index.js
+func writeSearchIndex(chapters []Chapter, outDir string) error {
+	idx := searchIndex{Index: make(map[string][]int)}
+	for _, ch := range chapters {
+		// 目录页和自动生成的页面 (索引、插图目录等) 不参与搜索
+		if ch.IsContents || len(ch.src.Lines) == 0 {
+			continue
+		}
+		for _, doc := range splitSearchDocs(ch) {
+			id := len(idx.Docs)
+			idx.Docs = append(idx.Docs, doc)
+			weights := make(map[string]int)
+			for _, t := range searchTokens(doc.Title) {
+				weights[t] += searchTitleWeight
+			}
+			for _, t := range searchTokens(doc.Body) {
+				weights[t]++
+			}
+			for t, w := range weights {
+				idx.Index[t] = append(idx.Index[t], id, w)
+			}
+		}
+	}
+
+	data, err := json.Marshal(idx)
+	if err != nil {
+		return fmt.Errorf("生成搜索索引失败: %w", err)
+	}
+	if err := os.WriteFile(filepath.Join(outDir, "search-index.json"), data, 0644); err != nil {
+		return fmt.Errorf("无法写入搜索索引: %w", err)
+	}
+	js := append([]byte("window.searchIndex = "), data...)
+	js = append(js, ";\n"...)
+	if err := os.WriteFile(filepath.Join(outDir, "search-index.js"), js, 0644); err != nil {
+		return fmt.Errorf("无法写入搜索索引: %w", err)
+	}
+	return nil
+}
+
+// splitSearchDocs 按标题把一章切成若干段
+func splitSearchDocs(ch Chapter) []searchDoc {
+	content := searchSkipRe.ReplaceAllString(string(ch.Content), " ")
+	title := htmlToText(ch.Title)
+
+	var docs []searchDoc
+	add := func(anchor, heading, body string) {
+		body = htmlToText(body)
+		// 一级标题之前通常没有内容
+		if body == "" && anchor == "" {
+			return
+		}
+		docs = append(docs, searchDoc{Page: pageLink(ch.OutputFile), Anchor: anchor, Title: heading, Chapter: title, Body: body})
+	}
+
+	anchor, heading, last := "", title, 0
+	for _, m := range searchHeadingRe.FindAllStringSubmatchIndex(content, -1) {
+		add(anchor, heading, content[last:m[0]])
+		anchor = content[m[4]:m[5]]
+		heading = htmlToText(content[m[6]:m[7]])
+		last = m[1]
+	}
+	add(anchor, heading, content[last:])
+	return docs
+}
+
+// htmlToText 去掉标签，解码实体并合并空白。
+// 正文中还留着 pageHref 的链接标记 (见 resolveLinks)，一并去掉。
+func htmlToText(s string) string {
+	s = searchTagRe.ReplaceAllString(s, " ")
+	s = linkMarkRe.ReplaceAllString(s, "$1")
+	return strings.Join(strings.Fields(html.UnescapeString(s)), " ")
+}
+
+// searchTokens 把文本切分成搜索用的词: 拉丁字母和数字按单词切分 (转为小写，至少两个字符)，
+// 中日韩文字没有空格分词，连续的文字切成相邻两字的组合 (bigram)，单独一个字时保留单字。
+// 页面中的 JavaScript 用同样的规则切分查询词，两处需要保持一致。
+func searchTokens(s string) []string {
+	var tokens []string
+	var word []rune
+	var cjk []rune
+	flushWord := func() {
+		if len(word) >= 2 {
+			tokens = append(tokens, string(word))
+		}
+		word = word[:0]
+	}
+	flushCJK := func() {
+		if len(cjk) == 1 {
+			tokens = append(tokens, string(cjk))
+		}
+		for i := 0; i+1 < len(cjk); i++ {
+			tokens = append(tokens, string(cjk[i:i+2]))
+		}
+		cjk = cjk[:0]
+	}
+	for _, r := range strings.ToLower(s) {
+		switch {
+		case isCJK(r):
+			flushWord()
+			cjk = append(cjk, r)
+		case unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_':
+			flushCJK()
+			word = append(word, r)
+		default:
+			flushWord()
+			flushCJK()
+		}
+	}
+	flushWord()
+	flushCJK()
+	return tokens
+}
+
+func isCJK(r rune) bool {
+	return unicode.In(r, unicode.Han, unicode.Hiragana, unicode.Katakana, unicode.Hangul)
+}
@@ -0,0 +1,99 @@
+package core
+
+import (
+	"encoding/json"
+	"html/template"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"mdbook-gen/internal/config"
+)
+
+// 这些规则和 templates/search.js 中的 tokenize 相同，修改时两边一起改
+func TestSearchTokens(t *testing.T) {
+	tests := []struct {
+		text string
+		want []string
+	}{
+		{"Hello, World", []string{"hello", "world"}},
+		{"a b go", []string{"go"}},
+		{"snake_case 和 v2", []string{"snake_case", "和", "v2"}},
+		{"并发模型", []string{"并发", "发模", "模型"}},
+		{"Go的并发", []string{"go", "的并", "并发"}},
+		{"用 Go 写并发程序", []string{"用", "go", "写并", "并发", "发程", "程序"}},
+		{"Go语言2024年", []string{"go", "语言", "2024", "年"}},
+		{"ひらがなとカタカナ", []string{"ひら", "らが", "がな", "なと", "とカ", "カタ", "タカ", "カナ"}},
+		{"한국어 Café", []string{"한국", "국어", "café"}},
+		{"「引号」，标点。", []string{"引号", "标点"}},
+		{"", nil},
+	}
+	for _, tt := range tests {
+		got := searchTokens(tt.text)
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("searchTokens(%q) = %q，应该是 %q", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestSplitSearchDocs(t *testing.T) {
+	md := "# 并发\n\n简介。\n\n## Goroutine\n\n启动 `go f()`。\n\n```go\nfunc main() {}\n```\n\n### 调度 **细节**\n\n抢占式调度。\n\n## 空小节\n"
+	setConfig(t, config.Config{})
+	ch := Chapter{
+		Title:      "第 3 章 并发",
+		OutputFile: "03.00-concurrency.html",
+		Content:    template.HTML(renderChapter(testSource(md), "3.", false)),
+	}
+	tests := []struct {
+		anchor, title, body string
+	}{
+		{"并发", "并发", "简介。"}, // 一级标题之前没有内容，不单独成段
+		{"goroutine", "Goroutine", "启动 go f() 。"},
+		{"调度-细节", "调度 细节", "抢占式调度。"},
+		{"空小节", "空小节", ""},
+	}
+	docs := splitSearchDocs(ch)
+	if len(docs) != len(tests) {
+		t.Fatalf("切分出 %d 段，应该是 %d 段: %+v", len(docs), len(tests), docs)
+	}
+	for i, tt := range tests {
+		d := docs[i]
+		if d.Anchor != tt.anchor || d.Title != tt.title || d.Body != tt.body {
+			t.Errorf("第 %d 段为 (%q, %q, %q)，应该是 (%q, %q, %q)", i, d.Anchor, d.Title, d.Body, tt.anchor, tt.title, tt.body)
+		}
+		if d.Page != "03.00-concurrency.html" || d.Chapter != "第 3 章 并发" {
+			t.Errorf("第 %d 段的页面为 %q / %q", i, d.Page, d.Chapter)
+		}
+	}
+}
+
+func TestWriteSearchIndex(t *testing.T) {
+	setConfig(t, config.Config{})
+	dir := t.TempDir()
+	chapters := []Chapter{
+		{Title: "简介", OutputFile: "01.00-intro.html", src: testSource("# 简介"), Content: "<h1 id=\"简介\">简介</h1>\n<p>Go 并发</p>"},
+		{Title: "目录", OutputFile: "00.01-contents.html", IsContents: true, src: testSource("x"), Content: "<p>Go</p>"},
+	}
+	if err := writeSearchIndex(chapters, dir); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "search-index.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var idx searchIndex
+	if err := json.Unmarshal(data, &idx); err != nil {
+		t.Fatalf("search-index.json 不是合法的 JSON: %v", err)
+	}
+	if len(idx.Docs) != 1 || idx.Docs[0].Anchor != "简介" || len(idx.Index["并发"]) != 2 {
+		t.Errorf("索引内容不对: %s", data)
+	}
+	js, err := os.ReadFile(filepath.Join(dir, "search-index.js"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(js) != "window.searchIndex = "+string(data)+";\n" {
+		t.Errorf("search-index.js 和 search-index.json 的内容不一致")
+	}
+}
@@ -0,0 +1,85 @@
+package core
+
+import (
+	"fmt"
+	"strings"
+)
+
+// renderSidebar 生成侧边栏中的全书目录，数据和目录页相同 (tocEntries)。
+// 子章节放在所属章的下面，当前章节高亮并展开，其它章节的展开状态由页面脚本记住。
+func renderSidebar(chapters []Chapter, current Chapter) string {
+	var b strings.Builder
+	b.WriteString(`
+		<nav class="sidebar" id="sidebar" aria-label="目录">
+			<ol class="sidebar-tree">
+`)
+	entries := tocEntries(chapters, true)
+	for i := 0; i < len(entries); i++ {
+		e := entries[i]
+		if e.Part != "" {
+			b.WriteString(fmt.Sprintf("<li class=\"sidebar-part\">%s</li>\n", escapeHTML(e.Part)))
+		}
+
+		// 紧跟在后面的子章节
+		var subs []tocEntry
+		for i+1 < len(entries) && entries[i+1].Sub {
+			i++
+			subs = append(subs, entries[i])
+		}
+
+		isCurrent := e.Href == current.OutputFile
+		for _, sub := range subs {
+			isCurrent = isCurrent || sub.Href == current.OutputFile
+		}
+		if len(e.Sections) == 0 && len(subs) == 0 {
+			b.WriteString(sidebarLink(e.Href, e.Label, isCurrent, nil))
+		} else {
+			b.WriteString(sidebarLink(e.Href, e.Label, e.Href == current.OutputFile, &isCurrent))
+			b.WriteString("<ol>\n")
+			for _, h := range e.Sections {
+				b.WriteString(sidebarSection(e.Href, h))
+			}
+			for _, sub := range subs {
+				b.WriteString(sidebarLink(sub.Href, sub.Label, sub.Href == current.OutputFile, nil))
+				if len(sub.Sections) > 0 {
+					b.WriteString("<ol>\n")
+					for _, h := range sub.Sections {
+						b.WriteString(sidebarSection(sub.Href, h))
+					}
+					b.WriteString("</ol>\n")
+				}
+				b.WriteString("</li>\n")
+			}
+			b.WriteString("</ol>\n")
+		}
+		b.WriteString("</li>\n")
+	}
+	b.WriteString(`			</ol>
+		</nav>
+		<div class="sidebar-backdrop" id="sidebar-backdrop"></div>`)
+	return b.String()
+}
+
+// sidebarLink 输出一章的 <li> 开始部分，调用方负责写 </li>。
+// open 不为 nil 时这一章可以折叠，*open 表示默认展开。
+func sidebarLink(href, label string, active bool, open *bool) string {
+	class := []string{"sidebar-chapter"}
+	aria := ""
+	if active {
+		class = append(class, "active")
+		aria = ` aria-current="page"`
+	}
+	toggle := ""
+	if open != nil {
+		if *open {
+			class = append(class, "open", "current")
+		}
+		toggle = fmt.Sprintf(`<button class="sidebar-expand" aria-expanded="%t" aria-label="展开或折叠">&rsaquo;</button>`, *open)
+	}
+	return fmt.Sprintf(`<li class="%s" data-href="%s"><div class="sidebar-item">%s<a href="%s"%s>%s</a></div>`+"\n",
+		strings.Join(class, " "), href, toggle, pageHref(href), aria, escapeHTML(label))
+}
+
+func sidebarSection(href string, h heading) string {
+	return fmt.Sprintf("<li class=\"sidebar-section sidebar-h%d\"><a href=\"%s\">%s</a></li>\n", h.Level, pageHref(href+"#"+h.ID), headingTitle(h.Text))
+}
@@ -0,0 +1,170 @@
+package core
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// 对齐行: | :--- | :---: | ---: |
+var tableDelimRe = regexp.MustCompile(`^\|?\s*:?-+:?\s*(\|\s*:?-+:?\s*)*\|?$`)
+
+// isTableStart 判断第 i 行是否为表头: 本行含有 |，下一行是列数相同的对齐行
+func isTableStart(src source, i int) bool {
+	lines := src.Lines
+	if i+1 >= len(lines) || !strings.Contains(lines[i], "|") {
+		return false
+	}
+	delim := strings.TrimSpace(lines[i+1])
+	if !strings.Contains(delim, "|") || !tableDelimRe.MatchString(delim) {
+		return false
+	}
+	head, cols := len(splitTableRow(lines[i])), len(splitTableRow(delim))
+	if head != cols {
+		fmt.Printf("Warning: %s: 表头有 %d 列，对齐行有 %d 列，不作为表格处理\n", src.posAt(i), head, cols)
+		return false
+	}
+	return true
+}
+
+// isTableRow 判断表格之后的一行是否仍属于表格
+func isTableRow(line string) bool {
+	return strings.TrimSpace(line) != "" && strings.Contains(line, "|")
+}
+
+// splitTableRow 按 | 拆分单元格。\| 和代码片段中的 | 不作为分隔符。
+func splitTableRow(row string) []string {
+	row = strings.TrimSpace(row)
+	row = strings.TrimPrefix(row, "|")
+	if strings.HasSuffix(row, "|") && !strings.HasSuffix(row, `\|`) {
+		row = strings.TrimSuffix(row, "|")
+	}
+
+	var cells []string
+	var cell strings.Builder
+	for i := 0; i < len(row); i++ {
+		c := row[i]
+		switch {
+		case c == '\\' && i+1 < len(row) && row[i+1] == '|':
+			cell.WriteByte('|')
+			i++
+		case c == '`':
+			// 找到长度相同的结束反引号，整段原样保留
+			n := 1
+			for i+n < len(row) && row[i+n] == '`' {
+				n++
+			}
+			fence := row[i : i+n]
+			end := -1
+			for j := i + n; j < len(row); {
+				k := strings.Index(row[j:], fence)
+				if k < 0 {
+					break
+				}
+				k += j
+				if k+n < len(row) && row[k+n] == '`' {
+					for k < len(row) && row[k] == '`' {
+						k++
+					}
+					j = k
+					continue
+				}
+				end = k + n
+				break
+			}
+			if end < 0 {
+				cell.WriteString(fence)
+				i += n - 1
+				continue
+			}
+			cell.WriteString(strings.ReplaceAll(row[i:end], `\|`, "|"))
+			i = end - 1
+		case c == '|':
+			cells = append(cells, strings.TrimSpace(cell.String()))
+			cell.Reset()
+		default:
+			cell.WriteByte(c)
+		}
+	}
+	return append(cells, strings.TrimSpace(cell.String()))
+}
+
+// tableAlign 解析对齐行，返回每一列的 text-align
+func tableAlign(delim string) []string {
+	cells := splitTableRow(delim)
+	align := make([]string, len(cells))
+	for i, c := range cells {
+		left, right := strings.HasPrefix(c, ":"), strings.HasSuffix(c, ":")
+		switch {
+		case left && right:
+			align[i] = "center"
+		case right:
+			align[i] = "right"
+		case left:
+			align[i] = "left"
+		}
+	}
+	return align
+}
+
+// renderTable 输出一张表格，第一行为表头，第二行为对齐行。
+// 以 \ 结尾的行和下一行合并成同一行，各单元格的内容以 <br> 连接 (多行单元格)。
+// 列数和表头不一致的行会补齐或截断，并给出提示。
+// numbered 为 true 时带 <caption>，编号由 numberFigures 在全书渲染完之后统一填写。
+func renderTable(table source, caption, label string, numbered bool) string {
+	var buf bytes.Buffer
+	if numbered {
+		buf.WriteString(fmt.Sprintf("<table data-tbl=\"%s\">\n<caption><span class=\"caption-label\"></span>%s</caption>\n", label, processInline(caption)))
+	} else {
+		buf.WriteString("<table>\n")
+	}
+
+	align := tableAlign(table.Lines[1])
+	buf.WriteString("<thead>\n" + renderTableRow(splitTableRow(table.Lines[0]), "th", align) + "</thead>\n")
+
+	var body bytes.Buffer
+	for i := 2; i < len(table.Lines); i++ {
+		pos := table.posAt(i)
+		cells := splitTableRow(strings.TrimSuffix(strings.TrimSpace(table.Lines[i]), `\`))
+		for strings.HasSuffix(strings.TrimSpace(table.Lines[i]), `\`) && i+1 < len(table.Lines) {
+			i++
+			more := splitTableRow(strings.TrimSuffix(strings.TrimSpace(table.Lines[i]), `\`))
+			for k, c := range more {
+				if k >= len(cells) {
+					cells = append(cells, c)
+				} else if c != "" {
+					cells[k] += "<br>" + c
+				}
+			}
+		}
+		if len(cells) != len(align) {
+			fmt.Printf("Warning: %s: 表格行有 %d 列，表头有 %d 列\n", pos, len(cells), len(align))
+		}
+		body.WriteString(renderTableRow(cells, "td", align))
+	}
+	if body.Len() > 0 {
+		buf.WriteString("<tbody>\n" + body.String() + "</tbody>\n")
+	}
+	buf.WriteString("</table>\n")
+	return buf.String()
+}
+
+// renderTableRow 输出一行，单元格数量按表头的列数补齐或截断
+func renderTableRow(cells []string, tag string, align []string) string {
+	var buf bytes.Buffer
+	buf.WriteString("<tr>\n")
+	for i, a := range align {
+		text := ""
+		if i < len(cells) {
+			text = cells[i]
+		}
+		style := ""
+		if a != "" {
+			style = fmt.Sprintf(` style="text-align: %s"`, a)
+		}
+		buf.WriteString(fmt.Sprintf("<%s%s>%s</%s>\n", tag, style, processInline(text), tag))
+	}
+	buf.WriteString("</tr>\n")
+	return buf.String()
+}
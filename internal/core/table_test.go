@@ -0,0 +1,90 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"mdbook-gen/internal/config"
+)
+
+func TestSplitTableRow(t *testing.T) {
+	tests := []struct {
+		name, row string
+		want      []string
+	}{
+		{"两侧有竖线", "| a | b |", []string{"a", "b"}},
+		{"两侧没有竖线", "a | b", []string{"a", "b"}},
+		{"空单元格", "| a || c |", []string{"a", "", "c"}},
+		{"转义的竖线", `| a \| b | c |`, []string{"a | b", "c"}},
+		{"行末转义的竖线", `| a | b \|`, []string{"a", "b |"}},
+		{"代码中的竖线", "| `a|b` | c |", []string{"`a|b`", "c"}},
+		{"代码中转义的竖线", "| `a\\|b` | c |", []string{"`a|b`", "c"}},
+		{"双反引号", "| ``a`|`b`` | c |", []string{"``a`|`b``", "c"}},
+		{"没有结束的反引号", "| `a | b |", []string{"`a", "b"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := splitTableRow(tt.row)
+			if strings.Join(got, "\x00") != strings.Join(tt.want, "\x00") {
+				t.Errorf("splitTableRow(%q) = %q，应该是 %q", tt.row, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTableAlign(t *testing.T) {
+	got := tableAlign("| --- | :--- | :---: | ---: |")
+	want := []string{"", "left", "center", "right"}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Errorf("tableAlign = %q，应该是 %q", got, want)
+	}
+}
+
+func TestTables(t *testing.T) {
+	tests := []struct {
+		name, md string
+		want     []string
+		warning  string
+	}{
+		{
+			name: "对齐和转义的竖线",
+			md:   "| 运算 | 写法 |\n| :--- | ---: |\n| 或 | `a \\| b` |\n| 管道 | x \\| y |",
+			want: []string{
+				`<th style="text-align: left">运算</th>`,
+				`<td style="text-align: right"><code>a | b</code></td>`,
+				`<td style="text-align: right">x | y</td>`,
+			},
+		},
+		{
+			name: "多行单元格",
+			md:   "| a | b |\n| - | - |\n| 1 | 2 \\\n|   | 3 |",
+			want: []string{"<td>2<br>3</td>"},
+		},
+		{
+			name:    "列数不足的行补齐",
+			md:      "| a | b |\n| - | - |\n| 1 |",
+			want:    []string{"<td>1</td>\n<td></td>"},
+			warning: "Warning: test.md:3: 表格行有 1 列，表头有 2 列\n",
+		},
+		{
+			name:    "对齐行的列数不同",
+			md:      "| a | b |\n| - |",
+			want:    []string{"<p>"},
+			warning: "Warning: test.md:1: 表头有 2 列，对齐行有 1 列，不作为表格处理\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out string
+			warnings := captureOutput(t, func() { out = renderMarkdown(t, config.Config{}, tt.md) })
+			for _, w := range tt.want {
+				if !strings.Contains(out, w) {
+					t.Errorf("输出中没有 %s:\n%s", w, out)
+				}
+			}
+			if warnings != tt.warning {
+				t.Errorf("警告 %q，应该是 %q", warnings, tt.warning)
+			}
+		})
+	}
+}
@@ -0,0 +1,142 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// 默认去掉标题开头的 "第 N 章："，章号由目录自己显示
+const defaultTitlePrefix = `^第\s*\d+\s*章[：:]\s*`
+
+// toc.strip_prefixes 编译后的正则，由 compileTOCConfig 设置
+var titlePrefixRes []*regexp.Regexp
+
+// compileTOCConfig 检查 toc 设置并编译标题前缀的正则
+func compileTOCConfig() {
+	switch conf.TOC.Depth {
+	case 0:
+		conf.TOC.Depth = 2
+	case 1, 2, 3:
+	default:
+		fmt.Printf("Warning: toc.depth 只能是 1 (只列章节)、2 (到二级标题) 或 3 (到三级标题)，使用 2\n")
+		conf.TOC.Depth = 2
+	}
+	switch conf.TOC.Numbering {
+	case "", "arabic", "chinese", "roman":
+	default:
+		fmt.Printf("Warning: 未知的 toc.numbering 设置 %q，使用 arabic\n", conf.TOC.Numbering)
+		conf.TOC.Numbering = "arabic"
+	}
+	switch conf.TOC.FrontNumbering {
+	case "", "none", "roman":
+	default:
+		fmt.Printf("Warning: 未知的 toc.front_numbering 设置 %q，使用 none\n", conf.TOC.FrontNumbering)
+		conf.TOC.FrontNumbering = "none"
+	}
+
+	patterns := conf.TOC.StripPrefixes
+	if patterns == nil {
+		patterns = []string{defaultTitlePrefix}
+	}
+	titlePrefixRes = nil
+	for _, p := range patterns {
+		re, err := regexp.Compile(p)
+		if err != nil {
+			fmt.Printf("Warning: toc.strip_prefixes 中的正则 %q 无效: %v\n", p, err)
+			continue
+		}
+		titlePrefixRes = append(titlePrefixRes, re)
+	}
+}
+
+// chapterLabel 是章节在目录、侧边栏和翻页链接中显示的名字，例如 "2.1. 并发"
+func chapterLabel(ch Chapter) string {
+	// Simplify title display
+	title := ch.Title
+	for _, re := range titlePrefixRes {
+		title = re.ReplaceAllString(title, "")
+	}
+	if conf.TOC.HideNumbers {
+		return title
+	}
+	if ch.IsFront {
+		if conf.TOC.FrontNumbering == "roman" && ch.FrontIndex > 0 {
+			return strings.ToLower(romanNumeral(ch.FrontIndex)) + ". " + title
+		}
+		return title
+	}
+	// 自动生成的页面 (插图目录等) 没有章号
+	if ch.Number == "" {
+		return title
+	}
+	return chapterNumber(ch.Number) + " " + title
+}
+
+// numberFrontMatter 按顺序给前言页面编号，toc.front_numbering 为 roman 时显示为 i.、ii.、iii.
+func numberFrontMatter(chapters []Chapter) {
+	n := 0
+	for i := range chapters {
+		if chapters[i].IsFront {
+			n++
+			chapters[i].FrontIndex = n
+		}
+	}
+}
+
+// chapterNumber 按 toc.numbering 显示章号: arabic "2.1." | chinese "第二章"、"第一节" | roman "II.1."
+func chapterNumber(number string) string {
+	var parts []int
+	for _, p := range strings.Split(strings.TrimSuffix(number, "."), ".") {
+		n, _ := strconv.Atoi(p)
+		parts = append(parts, n)
+	}
+	switch conf.TOC.Numbering {
+	case "chinese":
+		if len(parts) == 1 {
+			return "第" + chineseNumeral(parts[0]) + "章"
+		}
+		return "第" + chineseNumeral(parts[len(parts)-1]) + "节"
+	case "roman":
+		return romanNumeral(parts[0]) + strings.TrimPrefix(number, strconv.Itoa(parts[0]))
+	}
+	// Remove trailing dot from number for display if present
+	return strings.TrimSuffix(number, ".") + "."
+}
+
+// chineseNumeral 把 1–99 转换为中文数字: 1 -> 一，10 -> 十，21 -> 二十一
+func chineseNumeral(n int) string {
+	digits := []string{"零", "一", "二", "三", "四", "五", "六", "七", "八", "九"}
+	switch {
+	case n < 0 || n >= 100:
+		return strconv.Itoa(n)
+	case n < 10:
+		return digits[n]
+	}
+	s := "十"
+	if n >= 20 {
+		s = digits[n/10] + s
+	}
+	if n%10 != 0 {
+		s += digits[n%10]
+	}
+	return s
+}
+
+// romanNumeral 把 1–3999 转换为大写罗马数字
+func romanNumeral(n int) string {
+	if n <= 0 || n >= 4000 {
+		return strconv.Itoa(n)
+	}
+	values := []int{1000, 900, 500, 400, 100, 90, 50, 40, 10, 9, 5, 4, 1}
+	symbols := []string{"M", "CM", "D", "CD", "C", "XC", "L", "XL", "X", "IX", "V", "IV", "I"}
+	var b strings.Builder
+	for i, v := range values {
+		for n >= v {
+			b.WriteString(symbols[i])
+			n -= v
+		}
+	}
+	return b.String()
+}
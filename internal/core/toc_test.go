@@ -0,0 +1,87 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"mdbook-gen/internal/config"
+)
+
+func TestChapterLabel(t *testing.T) {
+	tests := []struct {
+		toc  config.TOCConfig
+		ch   Chapter
+		want string
+	}{
+		{config.TOCConfig{}, Chapter{Title: "第 2 章：并发", Number: "2."}, "2. 并发"},
+		{config.TOCConfig{}, Chapter{Title: "调度", Number: "2.1."}, "2.1. 调度"},
+		{config.TOCConfig{Numbering: "chinese"}, Chapter{Title: "并发", Number: "12."}, "第十二章 并发"},
+		{config.TOCConfig{Numbering: "chinese"}, Chapter{Title: "调度", Number: "2.1."}, "第一节 调度"},
+		{config.TOCConfig{Numbering: "roman"}, Chapter{Title: "调度", Number: "14.1."}, "XIV.1. 调度"},
+		{config.TOCConfig{HideNumbers: true}, Chapter{Title: "并发", Number: "2."}, "并发"},
+		{config.TOCConfig{StripPrefixes: []string{}}, Chapter{Title: "第 2 章：并发", Number: "2."}, "2. 第 2 章：并发"},
+		{config.TOCConfig{}, Chapter{Title: "插图目录"}, "插图目录"},
+		{config.TOCConfig{}, Chapter{Title: "前言", IsFront: true, FrontIndex: 1}, "前言"},
+		{config.TOCConfig{FrontNumbering: "roman"}, Chapter{Title: "前言", IsFront: true, FrontIndex: 1}, "i. 前言"},
+		{config.TOCConfig{FrontNumbering: "roman"}, Chapter{Title: "致谢", IsFront: true, FrontIndex: 4}, "iv. 致谢"},
+	}
+	for _, tt := range tests {
+		setConfig(t, config.Config{TOC: tt.toc})
+		if got := chapterLabel(tt.ch); got != tt.want {
+			t.Errorf("chapterLabel(%q) = %q，应该是 %q", tt.ch.Title, got, tt.want)
+		}
+	}
+}
+
+func TestNumberFrontMatter(t *testing.T) {
+	chapters := []Chapter{{IsFront: true}, {IsContents: true}, {IsFront: true}, {Number: "1."}}
+	numberFrontMatter(chapters)
+	for i, want := range []int{1, 0, 2, 0} {
+		if chapters[i].FrontIndex != want {
+			t.Errorf("第 %d 页的 FrontIndex = %d，应该是 %d", i, chapters[i].FrontIndex, want)
+		}
+	}
+}
+
+// testHeadingsMarkdown 的标题中有行内格式、转义字符和索引标记
+const testHeadingsMarkdown = "# 第 1 章：简介\n\n## 使用 `go vet` 和 **粗体**\n\n### a < b \\* c {index:比较}\n\n## [链接](https://example.com) {#link}\n"
+
+// headingTitlesWant 是 testHeadingsMarkdown 中三个标题显示的文字
+var headingTitlesWant = []string{">使用 go vet 和 粗体</a>", ">a &lt; b * c</a>", ">链接</a>"}
+
+func TestTOCHeadingTitles(t *testing.T) {
+	chapters := renderTestChapters(t, config.Config{TOC: config.TOCConfig{Depth: 3}}, testHeadingsMarkdown)
+	chapters[0].OutputFile, chapters[0].Title = "01.00-intro.html", "简介"
+	toc := generateTOC(chapters, "")
+	for _, w := range headingTitlesWant {
+		if !strings.Contains(toc, w) {
+			t.Errorf("目录中没有 %s:\n%s", w, toc)
+		}
+	}
+	for _, s := range []string{"`", "**", "{index", "](", "\\*"} {
+		if strings.Contains(toc, s) {
+			t.Errorf("目录中有 Markdown 原文 %s:\n%s", s, toc)
+		}
+	}
+}
+
+func TestSidebarHeadingTitles(t *testing.T) {
+	chapters := renderTestChapters(t, config.Config{TOC: config.TOCConfig{Depth: 3}}, testHeadingsMarkdown)
+	chapters[0].OutputFile, chapters[0].Title = "01.00-intro.html", "简介"
+	sidebar := renderSidebar(chapters, chapters[0])
+	for _, w := range headingTitlesWant {
+		if !strings.Contains(sidebar, w) {
+			t.Errorf("侧边栏中没有 %s:\n%s", w, sidebar)
+		}
+	}
+}
+
+func TestOutlineHeadingTitles(t *testing.T) {
+	chapters := renderTestChapters(t, config.Config{}, testHeadingsMarkdown)
+	outline := renderOutline(chapters[0])
+	for _, w := range headingTitlesWant {
+		if !strings.Contains(outline, w) {
+			t.Errorf("本页内容中没有 %s:\n%s", w, outline)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+package core
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	// 01.00-intro.html / 00.01-contents.html 中的编号前缀
+	numberedFileRe = regexp.MustCompile(`^\d+\.\d+-(.+)\.html$`)
+	// pageHref 留在页面中的链接标记，由 resolveLinks 替换
+	linkMarkRe = regexp.MustCompile("\x03([^\x03\x04]*)\x04")
+)
+
+// renameOutputs 按 urls.style 给所有页面改名，返回旧文件名到新文件名的对应关系。
+// 渲染时各处都用默认的文件名 (01.00-intro.html) 生成链接，写文件之前由 resolveLinks 统一替换。
+//
+//	numbered (默认): 01.00-intro.html
+//	slug:            intro.html，章节重新编号后地址不变
+//	directory:       intro/index.html，链接写成 intro/
+func renameOutputs(chapters []Chapter) map[string]string {
+	style := conf.URLs.Style
+	switch style {
+	case "", "numbered":
+		return nil
+	case "slug", "directory":
+	default:
+		fmt.Printf("Warning: 未知的 urls.style 设置 %q，可选 numbered、slug 或 directory\n", style)
+		conf.URLs.Style = "numbered"
+		return nil
+	}
+
+	rename := make(map[string]string)
+	used := make(map[string]string)
+	for i := range chapters {
+		old := chapters[i].OutputFile
+		name := strings.TrimSuffix(old, ".html")
+		if m := numberedFileRe.FindStringSubmatch(old); m != nil {
+			name = m[1]
+		}
+		file := name + ".html"
+		if style == "directory" {
+			file = name + "/index.html"
+		}
+		if other, dup := used[file]; dup {
+			fmt.Printf("Warning: %s 和 %s 的地址都是 %s，%s 保留原来的文件名\n", other, old, file, old)
+			continue
+		}
+		used[file] = old
+		rename[old] = file
+		chapters[i].OutputFile = file
+	}
+	return rename
+}
+
+// pageHref 返回指向书中页面或资源 (如 assets/img/a.png) 的链接，target 是相对于书籍根目录的路径。
+// 页面的最终文件名和所在的目录要到写文件时才确定，这里先留下标记，由 resolveLinks 替换。
+// 锚点、绝对路径和外部链接原样返回。
+func pageHref(target string) string {
+	if target == "" || strings.HasPrefix(target, "#") || strings.HasPrefix(target, "/") || schemeRe.MatchString(target) {
+		return target
+	}
+	return "\x03" + target + "\x04"
+}
+
+// resolveLinks 把页面 file 中 pageHref 留下的标记替换成最终的链接:
+// 页面改名，并加上到书籍根目录的前缀 (urls.base_url，或者子目录中的 "../")
+func resolveLinks(page, file string, rename map[string]string) string {
+	root := siteRoot(file)
+	return linkMarkRe.ReplaceAllStringFunc(page, func(m string) string {
+		return relink(m[1:len(m)-1], root, rename)
+	})
+}
+
+// relink 改写一个链接，root 是到书籍根目录的前缀。锚点、绝对路径和外部链接保持不变。
+func relink(target, root string, rename map[string]string) string {
+	if target == "" || strings.HasPrefix(target, "#") || strings.HasPrefix(target, "/") || schemeRe.MatchString(target) {
+		return target
+	}
+	path, suffix := target, ""
+	if i := strings.IndexAny(target, "?#"); i >= 0 {
+		path, suffix = target[:i], target[i:]
+	}
+	if renamed, ok := rename[path]; ok {
+		path = renamed
+	}
+	link := root + pageLink(path)
+	if link == "" {
+		link = "./"
+	}
+	return link + suffix
+}
+
+// siteRoot 返回从页面 file 到书籍根目录的路径前缀
+func siteRoot(file string) string {
+	if base := conf.URLs.BaseURL; base != "" {
+		return strings.TrimSuffix(base, "/") + "/"
+	}
+	return strings.Repeat("../", strings.Count(file, "/"))
+}
+
+// pageLink 返回页面的链接地址，urls.style 为 directory 时去掉结尾的 index.html
+func pageLink(file string) string {
+	if conf.URLs.Style == "directory" && (file == "index.html" || strings.HasSuffix(file, "/index.html")) {
+		return strings.TrimSuffix(file, "index.html")
+	}
+	return file
+}
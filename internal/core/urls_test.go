@@ -0,0 +1,133 @@
+package core
+
+import (
+	"strings"
+	"testing"
+
+	"mdbook-gen/internal/config"
+)
+
+func testChapters(files ...string) []Chapter {
+	var chapters []Chapter
+	for _, f := range files {
+		chapters = append(chapters, Chapter{OutputFile: f})
+	}
+	return chapters
+}
+
+func TestRenameOutputs(t *testing.T) {
+	files := []string{"00.00-front-matter.html", "01.00-intro.html", "01.01-setup.html", "references.html"}
+	tests := []struct {
+		style string
+		want  []string
+	}{
+		{"", files},
+		{"numbered", files},
+		{"slug", []string{"front-matter.html", "intro.html", "setup.html", "references.html"}},
+		{"directory", []string{"front-matter/index.html", "intro/index.html", "setup/index.html", "references/index.html"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.style, func(t *testing.T) {
+			setConfig(t, config.Config{URLs: config.URLsConfig{Style: tt.style}})
+			chapters := testChapters(files...)
+			rename := renameOutputs(chapters)
+			for i, ch := range chapters {
+				if ch.OutputFile != tt.want[i] {
+					t.Errorf("%s 改名为 %s，应该是 %s", files[i], ch.OutputFile, tt.want[i])
+				}
+				if tt.want[i] != files[i] && rename[files[i]] != tt.want[i] {
+					t.Errorf("rename[%s] = %q，应该是 %q", files[i], rename[files[i]], tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRenameOutputsCollision(t *testing.T) {
+	setConfig(t, config.Config{URLs: config.URLsConfig{Style: "slug"}})
+	chapters := testChapters("01.00-intro.html", "02.00-intro.html")
+	var rename map[string]string
+	out := captureOutput(t, func() { rename = renameOutputs(chapters) })
+	if chapters[0].OutputFile != "intro.html" || chapters[1].OutputFile != "02.00-intro.html" {
+		t.Errorf("文件名为 %s 和 %s", chapters[0].OutputFile, chapters[1].OutputFile)
+	}
+	if _, ok := rename["02.00-intro.html"]; ok {
+		t.Error("重名的页面不应该改名")
+	}
+	if !strings.Contains(out, "01.00-intro.html 和 02.00-intro.html 的地址都是 intro.html") {
+		t.Errorf("没有重名的警告: %q", out)
+	}
+}
+
+func TestUnknownURLStyle(t *testing.T) {
+	setConfig(t, config.Config{URLs: config.URLsConfig{Style: "pretty"}})
+	chapters := testChapters("01.00-intro.html")
+	out := captureOutput(t, func() { renameOutputs(chapters) })
+	if chapters[0].OutputFile != "01.00-intro.html" || !strings.Contains(out, `未知的 urls.style 设置 "pretty"`) {
+		t.Errorf("未知的设置应该按 numbered 处理并给出警告: %s %q", chapters[0].OutputFile, out)
+	}
+}
+
+func TestResolveLinks(t *testing.T) {
+	tests := []struct {
+		name, style, base, file, target, want string
+	}{
+		{"numbered", "", "", "01.00-intro.html", "02.00-next.html", "02.00-next.html"},
+		{"numbered 锚点", "", "", "01.00-intro.html", "02.00-next.html#top", "02.00-next.html#top"},
+		{"numbered 资源", "", "", "01.00-intro.html", "assets/img/a.png", "assets/img/a.png"},
+		{"slug", "slug", "", "intro.html", "02.00-next.html#top", "next.html#top"},
+		{"slug 查询参数", "slug", "", "intro.html", "02.00-next.html?x=1#top", "next.html?x=1#top"},
+		{"slug 首页", "slug", "", "index.html", "01.00-intro.html", "intro.html"},
+		{"directory", "directory", "", "intro/index.html", "02.00-next.html#top", "../next/#top"},
+		{"directory 资源", "directory", "", "intro/index.html", "assets/css/main.css", "../assets/css/main.css"},
+		{"directory 首页", "directory", "", "intro/index.html", "index.html", "../"},
+		{"directory 根目录的首页", "directory", "", "index.html", "index.html", "./"},
+		{"directory 从首页", "directory", "", "index.html", "01.00-intro.html#a", "intro/#a"},
+		{"base_url", "", "/docs/book", "01.00-intro.html", "02.00-next.html#top", "/docs/book/02.00-next.html#top"},
+		{"base_url 结尾的 /", "slug", "https://example.com/book/", "intro.html", "02.00-next.html", "https://example.com/book/next.html"},
+		{"base_url 和 directory", "directory", "/book", "intro/index.html", "02.00-next.html#top", "/book/next/#top"},
+		{"base_url 首页", "directory", "/book", "intro/index.html", "index.html", "/book/"},
+		{"没有改名的页面", "slug", "", "intro.html", "search-index.js", "search-index.js"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setConfig(t, config.Config{URLs: config.URLsConfig{Style: tt.style, BaseURL: tt.base}})
+			rename := renameOutputs(testChapters("01.00-intro.html", "02.00-next.html"))
+			page := `<a href="` + pageHref(tt.target) + `">x</a>`
+			if got, want := resolveLinks(page, tt.file, rename), `<a href="`+tt.want+`">x</a>`; got != want {
+				t.Errorf("%s 中的 %s = %s，应该是 %s", tt.file, tt.target, got, want)
+			}
+		})
+	}
+}
+
+func TestPageHrefUnchanged(t *testing.T) {
+	setConfig(t, config.Config{URLs: config.URLsConfig{Style: "directory", BaseURL: "/book"}})
+	for _, target := range []string{"", "#top", "/abs/path.html", "https://example.com/a.html", "mailto:a@example.com"} {
+		if got := pageHref(target); got != target {
+			t.Errorf("pageHref(%q) = %q，应该原样返回", target, got)
+		}
+		if got := resolveLinks(pageHref(target), "intro/index.html", nil); got != target {
+			t.Errorf("resolveLinks(%q) = %q，应该原样返回", target, got)
+		}
+	}
+}
+
+func TestLinksInChapter(t *testing.T) {
+	md := "见 [下一章](02.00-next.html#top) 和 ![图](assets/img/a.png)。\n\n```html\n<a href=\"02.00-next.html\">\n```"
+	setConfig(t, config.Config{URLs: config.URLsConfig{Style: "directory"}})
+	content := renderChapter(testSource(md), "1.", false)
+	rename := renameOutputs(testChapters("01.00-intro.html", "02.00-next.html"))
+	out := resolveLinks(content, "intro/index.html", rename)
+	for _, w := range []string{`<a href="../next/#top">下一章</a>`, `src="../assets/img/a.png"`, `&lt;a href="02.00-next.html"&gt;`} {
+		if !strings.Contains(out, w) {
+			t.Errorf("输出中没有 %s:\n%s", w, out)
+		}
+	}
+	if strings.ContainsAny(out, "\x03\x04") {
+		t.Errorf("输出中还有链接标记:\n%q", out)
+	}
+	if text := htmlToText(content + "\x0302.00-next.html\x04"); strings.ContainsAny(text, "\x03\x04") {
+		t.Errorf("搜索用的文字中还有链接标记: %q", text)
+	}
+}
@@ -2,5 +2,5 @@ package templates
 
 import "embed"
 
-//go:embed main.css book.yaml sample/*.md
+//go:embed main.css search.js sidebar.js reading.js prefs.js book.yaml sample/*.md
 var Assets embed.FS
@@ -0,0 +1,99 @@
+// Reader preferences: theme, font size, line width and font family, stored in localStorage.
+// The saved values are applied by a small inline script in <head> before the page is shown;
+// this file only wires up the panel.
+(function () {
+	const toggle = document.getElementById('prefs-toggle');
+	const panel = document.getElementById('prefs-panel');
+	if (!toggle || !panel) {
+		return;
+	}
+	const root = document.documentElement;
+	const darkQuery = window.matchMedia('(prefers-color-scheme: dark)');
+	const scales = [0.85, 0.925, 1, 1.1, 1.2, 1.35];
+	const defaultTheme = panel.dataset.defaultTheme || 'auto';
+
+	let prefs = {};
+	try { prefs = JSON.parse(localStorage.getItem('mdbook-gen.prefs')) || {}; } catch (e) {}
+	const save = () => {
+		try { localStorage.setItem('mdbook-gen.prefs', JSON.stringify(prefs)); } catch (e) {}
+	};
+
+	const apply = () => {
+		const theme = prefs.theme || defaultTheme;
+		if (theme === 'auto') {
+			delete root.dataset.theme;
+		} else {
+			root.dataset.theme = theme;
+		}
+		const dark = theme === 'dark' || (theme === 'auto' && darkQuery.matches);
+		const light = document.getElementById('hljs-light');
+		const darkStyle = document.getElementById('hljs-dark');
+		if (light && darkStyle) {
+			light.media = dark ? 'not all' : 'all';
+			darkStyle.media = dark ? 'all' : 'not all';
+		}
+
+		if (prefs.font === 'serif') {
+			root.dataset.font = 'serif';
+		} else {
+			delete root.dataset.font;
+		}
+		root.style.setProperty('--font-scale', prefs.scale || 1);
+		if (prefs.width) {
+			root.style.setProperty('--content-width', prefs.width + 'px');
+		} else {
+			root.style.removeProperty('--content-width');
+		}
+
+		panel.querySelectorAll('[data-pref]').forEach(button => {
+			const key = button.dataset.pref;
+			const current = key === 'theme' ? theme : String(prefs[key] || button.closest('.prefs-options').dataset.default);
+			button.setAttribute('aria-pressed', button.dataset.value === current);
+		});
+		const size = panel.querySelector('.prefs-size');
+		if (size) {
+			size.textContent = Math.round((prefs.scale || 1) * 100) + '%';
+		}
+	};
+
+	panel.addEventListener('click', evt => {
+		const button = evt.target.closest('button');
+		if (!button) {
+			return;
+		}
+		if (button.dataset.pref) {
+			const value = button.dataset.value;
+			prefs[button.dataset.pref] = button.dataset.pref === 'width' ? Number(value) : value;
+		} else if (button.dataset.step) {
+			const i = scales.indexOf(prefs.scale || 1);
+			const next = Math.min(scales.length - 1, Math.max(0, (i < 0 ? 2 : i) + Number(button.dataset.step)));
+			prefs.scale = scales[next];
+		} else if (button.dataset.reset !== undefined) {
+			prefs = {};
+		}
+		save();
+		apply();
+	});
+
+	toggle.addEventListener('click', () => {
+		panel.hidden = !panel.hidden;
+		toggle.setAttribute('aria-expanded', !panel.hidden);
+	});
+	document.addEventListener('click', evt => {
+		if (!panel.hidden && !evt.target.closest('.prefs')) {
+			panel.hidden = true;
+			toggle.setAttribute('aria-expanded', false);
+		}
+	});
+	document.addEventListener('keydown', evt => {
+		if (evt.key === 'Escape' && !panel.hidden) {
+			panel.hidden = true;
+			toggle.setAttribute('aria-expanded', false);
+			toggle.focus();
+		}
+	});
+
+	// Follow the system setting while the theme is "auto"
+	darkQuery.addEventListener('change', apply);
+	apply();
+})();
@@ -0,0 +1,45 @@
+// Reading aids: the reading progress bar and the "on this page" outline,
+// which highlights the heading currently being read.
+(function () {
+	const bar = document.getElementById('reading-progress');
+	const outline = document.getElementById('page-outline');
+
+	const links = new Map();
+	if (outline) {
+		outline.querySelectorAll('a').forEach(a => links.set(decodeURIComponent(a.hash.slice(1)), a));
+	}
+	const headings = Array.from(document.querySelectorAll('main h2[id], main h3[id]')).filter(h => links.has(h.id));
+
+	let current = null;
+	const update = () => {
+		if (bar) {
+			const doc = document.documentElement;
+			const max = doc.scrollHeight - window.innerHeight;
+			const ratio = max > 0 ? Math.min(1, window.scrollY / max) : 1;
+			bar.style.width = (ratio * 100) + '%';
+		}
+
+		let found = null;
+		for (const h of headings) {
+			if (h.getBoundingClientRect().top > 80) {
+				break;
+			}
+			found = h;
+		}
+		const link = found ? links.get(found.id) : null;
+		if (link === current) {
+			return;
+		}
+		if (current) {
+			current.classList.remove('active');
+		}
+		current = link;
+		if (current) {
+			current.classList.add('active');
+		}
+	};
+
+	window.addEventListener('scroll', update, { passive: true });
+	window.addEventListener('resize', update);
+	update();
+})();
@@ -0,0 +1,279 @@
+// Client-side full-text search over search-index.json generated at build time.
+// Tokenization must stay in sync with searchTokens in internal/core/search.go:
+// latin words (lowercased, at least 2 characters) and CJK bigrams.
+(function () {
+	const input = document.getElementById('search-input');
+	const results = document.getElementById('search-results');
+	if (!input || !results) {
+		return;
+	}
+
+	// Links in the index are relative to the book root, which is where assets/js/search.js lives
+	const root = document.currentScript.src.replace(/assets\/js\/search\.js(\?.*)?$/, '');
+
+	const cjkRe = /[\p{Script=Han}\p{Script=Hiragana}\p{Script=Katakana}\p{Script=Hangul}]/u;
+	const wordRe = /[\p{L}\p{Nd}_]/u;
+	const maxResults = 20;
+
+	const tokenize = text => {
+		const tokens = [];
+		let word = '';
+		let cjk = [];
+		const flushWord = () => {
+			if ([...word].length >= 2) {
+				tokens.push(word);
+			}
+			word = '';
+		};
+		const flushCJK = () => {
+			if (cjk.length === 1) {
+				tokens.push(cjk[0]);
+			}
+			for (let i = 0; i + 1 < cjk.length; i++) {
+				tokens.push(cjk[i] + cjk[i + 1]);
+			}
+			cjk = [];
+		};
+		for (const ch of text.toLowerCase()) {
+			if (cjkRe.test(ch)) {
+				flushWord();
+				cjk.push(ch);
+			} else if (wordRe.test(ch)) {
+				flushCJK();
+				word += ch;
+			} else {
+				flushWord();
+				flushCJK();
+			}
+		}
+		flushWord();
+		flushCJK();
+		return tokens;
+	};
+
+	// The index is loaded on first use. search-index.js works when the book is opened from file://,
+	// where fetch() is not allowed.
+	let index = null;
+	let keys = null;
+	let loading = null;
+	const load = () => {
+		if (loading) {
+			return loading;
+		}
+		loading = new Promise((resolve, reject) => {
+			if (window.searchIndex) {
+				resolve(window.searchIndex);
+				return;
+			}
+			const script = document.createElement('script');
+			script.src = root + 'search-index.js';
+			script.onload = () => resolve(window.searchIndex);
+			script.onerror = reject;
+			document.head.appendChild(script);
+		}).then(data => {
+			index = data;
+			keys = Object.keys(data.index).sort();
+		});
+		return loading;
+	};
+
+	// Postings for a token; the last query token also matches as a prefix so results update while typing.
+	const postings = (token, prefix) => {
+		const scores = new Map();
+		const addPostings = list => {
+			for (let i = 0; i < list.length; i += 2) {
+				scores.set(list[i], (scores.get(list[i]) || 0) + list[i + 1]);
+			}
+		};
+		if (!prefix) {
+			addPostings(index.index[token] || []);
+			return scores;
+		}
+		let lo = 0;
+		let hi = keys.length;
+		while (lo < hi) {
+			const mid = (lo + hi) >> 1;
+			if (keys[mid] < token) {
+				lo = mid + 1;
+			} else {
+				hi = mid;
+			}
+		}
+		for (let i = lo; i < keys.length && keys[i].startsWith(token); i++) {
+			addPostings(index.index[keys[i]]);
+		}
+		return scores;
+	};
+
+	const search = query => {
+		const tokens = [...new Set(tokenize(query))];
+		if (tokens.length === 0) {
+			return [];
+		}
+		let scores = null;
+		tokens.forEach((token, i) => {
+			const found = postings(token, i === tokens.length - 1);
+			if (scores === null) {
+				scores = found;
+				return;
+			}
+			const next = new Map();
+			for (const [doc, score] of scores) {
+				if (found.has(doc)) {
+					next.set(doc, score + found.get(doc));
+				}
+			}
+			scores = next;
+		});
+		return [...scores].sort((a, b) => b[1] - a[1]).slice(0, maxResults).map(([doc]) => index.docs[doc]);
+	};
+
+	const escapeHTML = s => s.replace(/[&<>"]/g, c => ({ '&': '&amp;', '<': '&lt;', '>': '&gt;', '"': '&quot;' }[c]));
+	const escapeRegExp = s => s.replace(/[.*+?^${}()|[\]\\]/g, '\\$&');
+
+	// Terms to highlight: whitespace-separated query words
+	const terms = query => query.trim().split(/\s+/).filter(Boolean);
+
+	const highlight = (text, words) => {
+		if (words.length === 0) {
+			return escapeHTML(text);
+		}
+		const re = new RegExp('(' + words.map(escapeRegExp).join('|') + ')', 'gi');
+		return text.split(re).map((part, i) => i % 2 === 1 ? '<mark>' + escapeHTML(part) + '</mark>' : escapeHTML(part)).join('');
+	};
+
+	const snippet = (body, words) => {
+		const lower = body.toLowerCase();
+		let at = -1;
+		for (const w of words) {
+			const i = lower.indexOf(w.toLowerCase());
+			if (i >= 0 && (at < 0 || i < at)) {
+				at = i;
+			}
+		}
+		const start = Math.max(0, at - 30);
+		let text = body.slice(start, start + 120);
+		if (start > 0) {
+			text = '…' + text;
+		}
+		if (start + 120 < body.length) {
+			text += '…';
+		}
+		return highlight(text, words);
+	};
+
+	let selected = -1;
+	const links = () => results.querySelectorAll('a');
+	const select = i => {
+		const items = links();
+		if (items.length === 0) {
+			return;
+		}
+		selected = (i + items.length) % items.length;
+		items.forEach((a, k) => a.classList.toggle('selected', k === selected));
+		items[selected].scrollIntoView({ block: 'nearest' });
+	};
+
+	const render = () => {
+		const query = input.value;
+		selected = -1;
+		if (query.trim() === '') {
+			results.hidden = true;
+			results.innerHTML = '';
+			return;
+		}
+		const found = search(query);
+		const words = terms(query);
+		if (found.length === 0) {
+			results.innerHTML = '<p class="search-empty">没有找到 “' + escapeHTML(query) + '”</p>';
+		} else {
+			results.innerHTML = '<ul>' + found.map(doc => {
+				const href = root + doc.p + '?highlight=' + encodeURIComponent(words.join(' ')) + (doc.a ? '#' + doc.a : '');
+				const title = doc.t && doc.t !== doc.c ? doc.c + ' › ' + doc.t : doc.c;
+				return '<li><a href="' + escapeHTML(href) + '"><span class="search-title">' + highlight(title, words) +
+					'</span><span class="search-snippet">' + snippet(doc.b, words) + '</span></a></li>';
+			}).join('') + '</ul>';
+		}
+		results.hidden = false;
+	};
+
+	input.addEventListener('focus', () => {
+		load().catch(() => {
+			results.innerHTML = '<p class="search-empty">无法加载搜索索引</p>';
+			results.hidden = false;
+		});
+	});
+	input.addEventListener('input', () => {
+		load().then(render);
+	});
+	input.addEventListener('keydown', evt => {
+		if (evt.key === 'ArrowDown') {
+			select(selected + 1);
+			evt.preventDefault();
+		} else if (evt.key === 'ArrowUp') {
+			select(selected - 1);
+			evt.preventDefault();
+		} else if (evt.key === 'Enter') {
+			const items = links();
+			if (items.length > 0) {
+				window.location.href = items[Math.max(selected, 0)].href;
+			}
+		} else if (evt.key === 'Escape') {
+			input.value = '';
+			render();
+			input.blur();
+		}
+	});
+	document.addEventListener('click', evt => {
+		if (!evt.target.closest('.search')) {
+			results.hidden = true;
+		}
+	});
+
+	// "/" or "s" focuses the search box
+	document.addEventListener('keydown', evt => {
+		const target = evt.target;
+		if (target.isContentEditable || /^(INPUT|TEXTAREA|SELECT)$/.test(target.tagName)) {
+			return;
+		}
+		if ((evt.key === '/' || evt.key === 's') && !evt.ctrlKey && !evt.metaKey && !evt.altKey) {
+			evt.preventDefault();
+			input.focus();
+		}
+	});
+
+	// Highlight the search terms on the page opened from a result
+	const params = new URLSearchParams(window.location.search);
+	const wanted = terms(params.get('highlight') || '');
+	if (wanted.length > 0) {
+		const re = new RegExp(wanted.map(escapeRegExp).join('|'), 'gi');
+		const walker = document.createTreeWalker(document.querySelector('main'), NodeFilter.SHOW_TEXT, {
+			acceptNode: node => node.parentElement.closest('pre, script, style, math, mark') ? NodeFilter.FILTER_REJECT : NodeFilter.FILTER_ACCEPT,
+		});
+		const nodes = [];
+		while (walker.nextNode()) {
+			nodes.push(walker.currentNode);
+		}
+		nodes.forEach(node => {
+			const text = node.nodeValue;
+			re.lastIndex = 0;
+			if (!re.test(text)) {
+				return;
+			}
+			re.lastIndex = 0;
+			const frag = document.createDocumentFragment();
+			let last = 0;
+			let m;
+			while ((m = re.exec(text)) !== null) {
+				frag.appendChild(document.createTextNode(text.slice(last, m.index)));
+				const mark = document.createElement('mark');
+				mark.className = 'search-hit';
+				mark.textContent = m[0];
+				frag.appendChild(mark);
+				last = m.index + m[0].length;
+			}
+			frag.appendChild(document.createTextNode(text.slice(last)));
+			node.parentNode.replaceChild(frag, node);
+		});
+	}
+})();
@@ -0,0 +1,104 @@
+// Sidebar navigation: open/closed state, expanded chapters and the section currently in view.
+// On screens narrower than 760px the sidebar is a drawer opened from the header button.
+(function () {
+	const sidebar = document.getElementById('sidebar');
+	const toggle = document.getElementById('sidebar-toggle');
+	const backdrop = document.getElementById('sidebar-backdrop');
+	if (!sidebar || !toggle) {
+		return;
+	}
+	const root = document.documentElement;
+	const mobile = window.matchMedia('(max-width: 760px)');
+
+	const load = key => {
+		try { return localStorage.getItem(key); } catch (e) { return null; }
+	};
+	const save = (key, value) => {
+		try { localStorage.setItem(key, value); } catch (e) {}
+	};
+
+	// Show or hide the sidebar; remembered on desktop, the drawer always starts closed
+	toggle.addEventListener('click', () => {
+		if (mobile.matches) {
+			root.classList.toggle('sidebar-open');
+			return;
+		}
+		const hidden = root.classList.toggle('sidebar-hidden');
+		save('mdbook-gen.sidebar', hidden ? 'hidden' : 'visible');
+	});
+	const closeDrawer = () => root.classList.remove('sidebar-open');
+	if (backdrop) {
+		backdrop.addEventListener('click', closeDrawer);
+	}
+	sidebar.addEventListener('click', evt => {
+		if (evt.target.closest('a')) {
+			closeDrawer();
+		}
+	});
+	document.addEventListener('keydown', evt => {
+		if (evt.key === 'Escape') {
+			closeDrawer();
+		}
+	});
+
+	// Expanded chapters; the current chapter is always expanded
+	let expanded = [];
+	try { expanded = JSON.parse(load('mdbook-gen.sidebar.open') || '[]'); } catch (e) {}
+	const setOpen = (item, open) => {
+		item.classList.toggle('open', open);
+		item.querySelector(':scope > .sidebar-item > .sidebar-expand').setAttribute('aria-expanded', open);
+	};
+	sidebar.querySelectorAll('.sidebar-expand').forEach(button => {
+		const item = button.closest('li');
+		if (!item.classList.contains('current') && expanded.includes(item.dataset.href)) {
+			setOpen(item, true);
+		}
+		button.addEventListener('click', () => {
+			const open = !item.classList.contains('open');
+			setOpen(item, open);
+			expanded = expanded.filter(href => href !== item.dataset.href);
+			if (open) {
+				expanded.push(item.dataset.href);
+			}
+			save('mdbook-gen.sidebar.open', JSON.stringify(expanded));
+		});
+	});
+
+	const active = sidebar.querySelector('.sidebar-chapter.active');
+	if (active) {
+		active.scrollIntoView({ block: 'center' });
+	}
+
+	// Highlight the section whose heading was scrolled past last
+	const links = new Map();
+	sidebar.querySelectorAll('.active .sidebar-section a').forEach(a => {
+		links.set(decodeURIComponent(a.hash.slice(1)), a);
+	});
+	const headings = Array.from(document.querySelectorAll('main h2[id], main h3[id]')).filter(h => links.has(h.id));
+	if (headings.length === 0) {
+		return;
+	}
+	let current = null;
+	const update = () => {
+		let found = null;
+		for (const h of headings) {
+			if (h.getBoundingClientRect().top > 80) {
+				break;
+			}
+			found = h;
+		}
+		const link = found ? links.get(found.id) : null;
+		if (link === current) {
+			return;
+		}
+		if (current) {
+			current.classList.remove('current-section');
+		}
+		current = link;
+		if (current) {
+			current.classList.add('current-section');
+		}
+	};
+	window.addEventListener('scroll', update, { passive: true });
+	update();
+})();